@@ -0,0 +1,66 @@
+package main
+
+import (
+	"time"
+)
+
+// AdaptiveTTLConfig derives the ttl of the records from how often the address changed recently
+type AdaptiveTTLConfig struct {
+	Enabled bool
+	Min     Seconds
+	Max     Seconds
+}
+
+const (
+	// adaptiveTTLHistory is the number of address changes per record type that are remembered
+	adaptiveTTLHistory = 6
+	// adaptiveTTLFraction is the part of the expected lifetime of an address that
+	// resolvers may cache it, so an outdated address is only served for a short time
+	adaptiveTTLFraction = 10
+)
+
+// recordTTL returns the ttl records of the type should have, which is RecordTTL unless AdaptiveTTL is enabled
+func recordTTL(config *DynDnsConfig, state *runState, recordType string) int {
+	if !config.AdaptiveTTL.Enabled {
+		return int(config.RecordTTL)
+	}
+
+	changes := state.Changes[recordType]
+	if len(changes) == 0 {
+		return int(config.AdaptiveTTL.Max)
+	}
+
+	// the time since the last change counts as well as soon as it is longer than the previous intervals,
+	// so the ttl rises again when the address becomes stable
+	var total time.Duration
+	intervals := 0
+	for i := 1; i < len(changes); i++ {
+		total += changes[i].Sub(changes[i-1])
+		intervals++
+	}
+	current := time.Since(changes[len(changes)-1])
+	if intervals == 0 || current > total/time.Duration(intervals) {
+		total += current
+		intervals++
+	}
+
+	lifetime := total / time.Duration(intervals)
+	ttl := int((lifetime / adaptiveTTLFraction).Truncate(time.Minute).Seconds())
+	return min(max(ttl, int(config.AdaptiveTTL.Min)), int(config.AdaptiveTTL.Max))
+}
+
+// observeAddress remembers when the detected address of a record type changed
+func (s *runState) observeAddress(recordType string, address string) {
+	if s.Observed[recordType] == address {
+		return
+	}
+
+	if _, known := s.Observed[recordType]; known {
+		changes := append(s.Changes[recordType], time.Now())
+		if len(changes) > adaptiveTTLHistory {
+			changes = changes[len(changes)-adaptiveTTLHistory:]
+		}
+		s.Changes[recordType] = changes
+	}
+	s.Observed[recordType] = address
+}
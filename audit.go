@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+)
+
+// auditEntry is a line of the AuditFile, written for every record that has been created or updated
+type auditEntry struct {
+	Time      time.Time
+	Provider  string
+	Zone      string
+	Name      string
+	Type      string
+	Action    recordAction
+	OldValue  string `json:",omitempty"`
+	NewValue  string
+	TTL       int
+	Simulated bool `json:",omitempty"`
+}
+
+// writeAuditLog appends the changes of the run as json lines to the AuditFile. Changes of a dry run
+// are only written with AuditDryRuns set and are marked as simulated
+func writeAuditLog(config *DynDnsConfig, summary *runSummary) {
+	if config.AuditFile == "" {
+		return
+	}
+
+	var lines []byte
+	for _, result := range summary.Results {
+		if result.Action != actionCreated && result.Action != actionUpdated {
+			continue
+		} else if result.Simulated && !config.AuditDryRuns {
+			continue
+		}
+
+		line, err := json.Marshal(auditEntry{
+			Time:      time.Now(),
+			Provider:  result.Provider.String(),
+			Zone:      result.Zone,
+			Name:      result.Name,
+			Type:      result.Type,
+			Action:    result.Action,
+			OldValue:  result.OldValue,
+			NewValue:  result.NewValue,
+			TTL:       result.TTL,
+			Simulated: result.Simulated,
+		})
+		if err != nil {
+			errorLog.Println("could not encode audit entry", err)
+			return
+		}
+		lines = append(append(lines, line...), '\n')
+	}
+	if len(lines) == 0 {
+		return
+	}
+
+	auditFile, err := os.OpenFile(config.AuditFile, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		errorLog.Println("could not open audit file", err)
+		return
+	}
+	defer func(auditFile *os.File) {
+		if err := auditFile.Close(); err != nil {
+			errorLog.Println("could not properly close audit file", err)
+		}
+	}(auditFile)
+
+	if _, err = auditFile.Write(lines); err != nil {
+		errorLog.Println("could not write audit file", err)
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// benchRounds is how often every source is requested by benchSources
+const benchRounds = 5
+
+// knownSources are public sources that are compared with the configured one by benchSources
+var knownSources = map[string][]string{
+	"A":    {"https://ipv4.seeip.org", "https://api.ipify.org", "https://ipv4.icanhazip.com"},
+	"AAAA": {"https://ipv6.seeip.org", "https://api6.ipify.org", "https://ipv6.icanhazip.com"},
+}
+
+type benchResult struct {
+	Source    string
+	Successes int
+	Total     time.Duration
+	Max       time.Duration
+	Values    []string
+}
+
+// benchSources requests the configured and the known sources of every record type several times
+// without retries and prints a table with their success rate, latency and the addresses they returned
+func benchSources(config *DynDnsConfig) int {
+	writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintln(writer, "TYPE\tSOURCE\tSUCCESS\tAVG\tMAX\tVALUES\tAGREES")
+
+	for _, recordType := range config.RecordTypeOrder {
+		recordConfig := config.recordConfig(recordType)
+		if !recordConfig.Enabled {
+			continue
+		}
+
+		candidates := []RecordConfig{*recordConfig}
+		for _, source := range knownSources[recordType] {
+			if source != recordConfig.Source || len(recordConfig.Interfaces) > 0 || recordConfig.FromIPv4 != "" {
+				candidate := *recordConfig
+				candidate.Source, candidate.SourcePath, candidate.Interfaces, candidate.FromIPv4 = source, "", nil, ""
+				candidates = append(candidates, candidate)
+			}
+		}
+
+		results := make([]benchResult, 0, len(candidates))
+		counts := map[string]int{}
+		for i := range candidates {
+			result := benchSource(config, recordType, &candidates[i])
+			for _, value := range result.Values {
+				counts[value]++
+			}
+			results = append(results, result)
+		}
+
+		// the address returned by most sources is taken as the right one
+		majority := ""
+		for value, count := range counts {
+			if count > counts[majority] || (count == counts[majority] && value < majority) {
+				majority = value
+			}
+		}
+
+		for _, result := range results {
+			average, values, agrees := "-", "-", "-"
+			if result.Successes > 0 {
+				average = (result.Total / time.Duration(result.Successes)).Round(time.Millisecond).String()
+				values = strings.Join(result.Values, ",")
+				agrees = "no"
+				if len(result.Values) == 1 && result.Values[0] == majority {
+					agrees = "yes"
+				}
+			}
+			_, _ = fmt.Fprintf(writer, "%s\t%s\t%d/%d\t%s\t%s\t%s\t%s\n", recordType, result.Source, result.Successes, benchRounds,
+				average, result.Max.Round(time.Millisecond), values, agrees)
+		}
+	}
+
+	if err := writer.Flush(); err != nil {
+		errorLog.Println("could not write benchmark", err)
+		return exitFailed
+	}
+	return 0
+}
+
+func benchSource(config *DynDnsConfig, recordType string, recordConfig *RecordConfig) benchResult {
+	recordConfig.SourceRetries = 0
+	result := benchResult{Source: sourceLabel(recordConfig)}
+	source := newIPSource(config, recordConfig)
+	for range benchRounds {
+		started := time.Now()
+		ip, err := source.Detect(context.Background(), recordType)
+		took := time.Since(started)
+		result.Max = max(result.Max, took)
+		if err != nil {
+			errorLog.Println(err)
+			continue
+		}
+
+		result.Successes++
+		result.Total += took
+		if value := ip.String(); !slices.Contains(result.Values, value) {
+			result.Values = append(result.Values, value)
+		}
+	}
+	return result
+}
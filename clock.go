@@ -0,0 +1,42 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"time"
+)
+
+// maxClockSkew is the allowed difference between the local clock and the Date header of api responses,
+// zero disables the check. It is set by configureApiClient.
+var maxClockSkew time.Duration
+
+// clockSkewed remembers whether the skew has already been reported to log it only once until the clock is fixed
+var clockSkewed bool
+
+// checkClockSkew compares the local clock with the Date header of an api response and warns if they differ
+// by more than maxClockSkew, because the features that depend on time like MaxIPAge and UpdateWindows
+// behave unexpectedly with a wrong clock
+func checkClockSkew(response *http.Response) {
+	if maxClockSkew == 0 {
+		return
+	}
+
+	serverTime, err := http.ParseTime(response.Header.Get("Date"))
+	if err != nil {
+		return
+	}
+
+	skew := time.Since(serverTime).Round(time.Second)
+	if skew.Abs() <= maxClockSkew {
+		if clockSkewed {
+			log.Println("local clock is in sync with the api again")
+			clockSkewed = false
+		}
+		return
+	}
+
+	if !clockSkewed {
+		warningLog.Printf("local clock differs from the time of the api by %s, check the time synchronization of this host\n", skew)
+		clockSkewed = true
+	}
+}
@@ -0,0 +1,764 @@
+package main
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+type DynDnsConfig struct {
+	Annotation
+	HetznerApiKey Secret
+	RecordTTL     Seconds
+	// UpdateTTL changes the ttl of existing records to RecordTTL if it differs by more than TTLTolerance seconds
+	UpdateTTL    bool
+	TTLTolerance int
+	// AdaptiveTTL replaces RecordTTL with a ttl based on how often the address changes, requires StateFile
+	AdaptiveTTL AdaptiveTTLConfig
+	Zones       map[string]ZoneConfig
+	// ZoneSelectors add the records to all zones of the primary account that match a label selector,
+	// the zones are listed once on startup
+	ZoneSelectors []ZoneSelector
+	// ZonesFile is the path of a file with additional zones in the same format as Zones,
+	// relative paths are resolved against the directory of the config
+	ZonesFile string
+	A         RecordConfig
+	AAAA      RecordConfig
+	// RecordTypeOrder is the order in which the record types are processed, A before AAAA by default
+	RecordTypeOrder []string
+	// SourceResolver is the address of a DNS server used to resolve the hostnames of the sources
+	// instead of the system resolver, the port defaults to 53
+	SourceResolver string
+	// Interval enables the daemon mode that checks all records repeatedly with this interval
+	Interval Duration
+	// MinInterval is the lower bound for Interval to protect against typos hammering the source and api
+	MinInterval Duration
+	// MaxIPAge reuses a detected address in following runs until it is older than this,
+	// network changes and SIGUSR1 always detect the address again
+	MaxIPAge Duration
+	// UseCachedOnDetectFailure keeps the records at the last detected address if the daemon can't detect it,
+	// as long as that has been detected less than MaxCachedAge ago
+	UseCachedOnDetectFailure bool
+	MaxCachedAge             Duration
+	// WatchNetwork enables the daemon mode that checks all records whenever an address
+	// of a network interface changes, can be combined with Interval
+	WatchNetwork bool
+	// MaxRunDuration exits the daemon with a stack dump if a run takes longer, for the supervisor to restart it
+	MaxRunDuration Duration
+	// ShutdownGracePeriod is how long the daemon waits for the current record to finish on SIGTERM
+	ShutdownGracePeriod Duration
+	// CreateGrace is waited before a missing record is requested again and only created if it is still missing,
+	// for records that might be created by another process at the same time
+	CreateGrace Duration
+	// OperationDelay is the minimum time between two api calls that create or update records
+	OperationDelay Duration
+	// HeartbeatUrl is requested after every run without failures
+	HeartbeatUrl string
+	// HeartbeatFail requests HeartbeatUrl with /fail appended after runs with failures
+	HeartbeatFail bool
+	// KeepOtherValues only manages the value marked with the comment "managed by hetzner_dyndns" and keeps
+	// all other values of the rrset, instead of replacing all of them with the address
+	KeepOtherValues bool
+	// LabelCreatedRecords adds the label managed-by=hetzner_dyndns to the rrsets that are created,
+	// to tell them apart from records that have been created by hand
+	LabelCreatedRecords bool
+	// UpdateWindows restricts creating and updating records to these time windows, if there are any
+	UpdateWindows UpdateWindows
+	// PrintZoneFile writes the managed records as zone file lines to stdout after each run
+	PrintZoneFile bool
+	// IPOutputFile is the path the detected addresses are written to after each run, e.g. for other scripts
+	IPOutputFile string
+	// ResultsFile is the path the action of every record and the detected addresses are written to as json
+	// after each run, replacing the results of the previous run
+	ResultsFile string
+	// MetricsFile is the path the summary of each run is written to in the Prometheus text format
+	MetricsFile string
+	// OtelEndpoint is the base url of an OTLP/HTTP collector that a trace of each run is sent to
+	OtelEndpoint string
+	// LowercaseNames converts all zone and record names to lowercase before they are used,
+	// enabled by default because DNS names are case-insensitive
+	LowercaseNames bool
+	// LogPrefix is put in front of every log message to distinguish multiple instances,
+	// {hostname} is replaced with the hostname of the machine
+	LogPrefix string
+	// LogFormat is either empty for plain log lines or "systemd" to prefix them with their syslog priority
+	LogFormat string
+	// ApiBaseUrl is the url of the Hetzner Cloud api, it is required to use https
+	ApiBaseUrl string
+	// VerifyApiKey checks on startup whether the api keys are allowed to change records and warns if they are read-only
+	VerifyApiKey bool
+	// ApiMinTLSVersion is the lowest tls version that is accepted by the api client, either "1.2" or "1.3"
+	ApiMinTLSVersion string
+	// ApiAccept is the Accept header of the api requests, the api version itself is part of ApiBaseUrl
+	ApiAccept string
+	// ApiMaxIdleConns and ApiIdleTimeout tune the connections that are kept open to the api between requests
+	ApiMaxIdleConns int
+	ApiIdleTimeout  Duration
+	// MaxClockSkew warns if the local clock differs from the Date header of the api by more than that
+	MaxClockSkew Duration
+	// LookupRetries is how often a record is requested again if that failed with a network or server error,
+	// records that still can't be requested are skipped and counted as failed
+	LookupRetries int
+	// AuditFile is the path of a file every created and updated record is appended to as a json line
+	AuditFile string
+	// AuditDryRuns also writes the changes of dry runs to the AuditFile, marked as simulated
+	AuditDryRuns bool
+	// StateFile is the path of a file that stores the last published addresses. If the address didn't
+	// change since then, no records are requested from the api at all
+	StateFile string
+	// SecondaryProviders are additional Hetzner accounts that all records are pushed to as well
+	SecondaryProviders []ProviderConfig
+
+	hetznerProviders []*hetznerProvider
+}
+
+type ProviderConfig struct {
+	Annotation
+	// Name is used in the logs to tell the providers apart
+	Name          string
+	HetznerApiKey Secret
+}
+
+// Secret is a string that never reveals its value when it is printed or encoded,
+// the actual value is only accessible with Value
+type Secret string
+
+const redactedSecret = "[redacted]"
+
+func (s Secret) Value() string {
+	return string(s)
+}
+
+func (s Secret) String() string {
+	return redactedSecret
+}
+
+func (s Secret) GoString() string {
+	return redactedSecret
+}
+
+func (s Secret) MarshalJSON() ([]byte, error) {
+	return json.Marshal(redactedSecret)
+}
+
+// Seconds is a number of seconds that is written either as a number or as a duration like "1h" in the config
+type Seconds int
+
+func (s *Seconds) UnmarshalJSON(data []byte) error {
+	var seconds int
+	if err := json.Unmarshal(data, &seconds); err == nil {
+		*s = Seconds(seconds)
+		return nil
+	}
+
+	var duration Duration
+	if err := duration.UnmarshalJSON(data); err != nil {
+		return fmt.Errorf("expected a number of seconds or a duration %w", err)
+	}
+	*s = Seconds(duration.Seconds())
+	return nil
+}
+
+// Duration is a time.Duration that is written as a string like "10m" in the config
+type Duration struct {
+	time.Duration
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	d.Duration = parsed
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+type RecordConfig struct {
+	Annotation
+	Enabled bool
+	Source  string
+	// SourcePath extracts the address from a json response of the source, e.g. .data.ip or .addresses[0]
+	SourcePath string
+	// SourceExtractFirst uses the first address in the response of the source, for sources that add other text
+	// like "192.0.2.1 (via proxy)". Otherwise the whole response has to be the address
+	SourceExtractFirst bool
+	// ForceFamily restricts the connection to the source to IPv4 for A and IPv6 for AAAA records,
+	// which is needed for dual-stack sources that answer with the address of the connection used
+	ForceFamily bool
+	// Interfaces replaces Source with the names of network interfaces in the order of their priority.
+	// The address of the first interface that has a global address of the right family is used
+	Interfaces []string
+	// FromIPv4 computes the address from the public IPv4 detected with the A config instead of using a source.
+	// {6to4} is replaced with the 6to4 prefix like 2002:c000:0201 and {ipv4} with the address itself
+	FromIPv4 string
+	// EUI64Interface keeps only the /64 prefix of the address from the source or interfaces
+	// and appends the EUI-64 interface identifier derived from the mac address of this interface
+	EUI64Interface string
+	// SkipIfUnavailable treats a source that can't be reached as success instead of failing all records,
+	// for hosts that don't always have connectivity of that family
+	SkipIfUnavailable bool
+	// FallbackIP is published instead of failing all records if the address can't be detected
+	FallbackIP string
+	// ConfirmChange detects the address again after a short delay before a record is changed to it
+	// and only changes the record if both addresses are the same
+	ConfirmChange bool
+	// HealthCheck skips the update if the detected address doesn't pass it
+	HealthCheck HealthCheck
+	// AcceptedStatusCodes are the status codes of the source that are accepted, 200 by default
+	AcceptedStatusCodes []int
+	// AcceptedContentTypes are the media types of the source responses that are accepted, any by default
+	AcceptedContentTypes []string
+	// SourceTimeout limits how long requesting the source and reading its response may take, 10 seconds by default
+	SourceTimeout Duration
+	// SourceRetries is how often the source is requested again if it can't be reached or stalls, once by default
+	SourceRetries int
+	// FollowRedirects follows up to MaxRedirects redirects of the source, enabled by default
+	FollowRedirects bool
+	MaxRedirects    int
+}
+
+// ZoneSelector applies the same records to every zone whose labels match the LabelSelector
+type ZoneSelector struct {
+	Annotation
+	// LabelSelector uses the syntax of the api, e.g. "env=prod" or "dyndns"
+	LabelSelector string
+	Records       []ZoneRecord
+}
+
+// Annotation holds fields that are only there to document the config and are ignored otherwise
+type Annotation struct {
+	Description string `json:",omitempty"`
+	Comment     string `json:"_comment,omitempty"`
+}
+
+// ZoneConfig lists the records of a zone. In the config it is either a plain list of records
+// or an object with the Enabled and Records fields to be able to disable the whole zone
+type ZoneConfig struct {
+	Annotation
+	Enabled bool
+	Records []ZoneRecord
+}
+
+// ZoneRecord is a single record name of a zone. In the config it is either just the name
+// or an object with the Name and Enabled fields to be able to disable the record
+type ZoneRecord struct {
+	Annotation
+	Name    string
+	Enabled bool
+	// PausedUntil suspends updating the record until this time, e.g. during maintenance of the host
+	PausedUntil time.Time `json:",omitzero"`
+}
+
+func (z *ZoneConfig) UnmarshalJSON(data []byte) error {
+	z.Enabled = true
+	if len(data) > 0 && data[0] == '[' {
+		return json.Unmarshal(data, &z.Records)
+	}
+
+	type plainZoneConfig ZoneConfig
+	return json.Unmarshal(data, (*plainZoneConfig)(z))
+}
+
+func (r *ZoneRecord) UnmarshalJSON(data []byte) error {
+	r.Enabled = true
+	if len(data) > 0 && data[0] == '"' {
+		return json.Unmarshal(data, &r.Name)
+	}
+
+	type plainZoneRecord ZoneRecord
+	return json.Unmarshal(data, (*plainZoneRecord)(r))
+}
+
+// activeRecords returns the names of all enabled records, or none if the zone itself is disabled
+func (z *ZoneConfig) activeRecords() []string {
+	if !z.Enabled {
+		return nil
+	}
+
+	var names []string
+	for _, record := range z.Records {
+		if record.Enabled {
+			names = append(names, record.Name)
+		}
+	}
+	return names
+}
+
+// pausedUntil returns the time until updating the record is paused, which is zero if it isn't
+func (z *ZoneConfig) pausedUntil(recordName string) time.Time {
+	var until time.Time
+	for _, record := range z.Records {
+		if record.Enabled && record.Name == recordName && record.PausedUntil.After(until) {
+			until = record.PausedUntil
+		}
+	}
+	return until
+}
+
+// defaultRecordTTL is the ttl of new records if RecordTTL isn't set
+const defaultRecordTTL Seconds = 300
+
+// isDaemon reports whether the records should be checked repeatedly instead of just once
+func (c *DynDnsConfig) isDaemon() bool {
+	return c.Interval.Duration != 0 || c.WatchNetwork
+}
+
+// readConfig reads the config file and applies the defaults, all errors are returned as ConfigError
+func readConfig(configPath string) (*DynDnsConfig, error) {
+	config := &DynDnsConfig{
+		RecordTTL: defaultRecordTTL,
+		AdaptiveTTL: AdaptiveTTLConfig{
+			Min: 60,
+			Max: 3600,
+		},
+		RecordTypeOrder:     []string{"A", "AAAA"},
+		MinInterval:         Duration{30 * time.Second},
+		MaxCachedAge:        Duration{time.Hour},
+		ShutdownGracePeriod: Duration{30 * time.Second},
+		LowercaseNames:      true,
+		ApiBaseUrl:          defaultApiBaseUrl,
+		ApiAccept:           "application/json",
+		ApiMinTLSVersion:    "1.2",
+		ApiMaxIdleConns:     4,
+		ApiIdleTimeout:      Duration{90 * time.Second},
+		A: RecordConfig{
+			Source:              "https://ipv4.seeip.org",
+			AcceptedStatusCodes: []int{http.StatusOK},
+			FollowRedirects:     true,
+			MaxRedirects:        3,
+			SourceTimeout:       Duration{10 * time.Second},
+			SourceRetries:       1,
+		},
+		AAAA: RecordConfig{
+			Source:              "https://ipv6.seeip.org",
+			AcceptedStatusCodes: []int{http.StatusOK},
+			FollowRedirects:     true,
+			MaxRedirects:        3,
+			SourceTimeout:       Duration{10 * time.Second},
+			SourceRetries:       1,
+		},
+	}
+
+	if err := decodeConfigFile(configPath, config, nil); err != nil {
+		return nil, &ConfigError{Err: err}
+	}
+
+	if err := validateApiBaseUrl(config.ApiBaseUrl); err != nil {
+		return nil, &ConfigError{Err: err}
+	}
+	config.ApiBaseUrl = strings.TrimSuffix(config.ApiBaseUrl, "/")
+	if _, err := parseTLSVersion(config.ApiMinTLSVersion); err != nil {
+		return nil, &ConfigError{Err: err}
+	}
+
+	if err := validateRecordTypeOrder(config.RecordTypeOrder); err != nil {
+		return nil, &ConfigError{Err: err}
+	}
+	if config.LogFormat != "" && config.LogFormat != "systemd" {
+		return nil, &ConfigError{Err: fmt.Errorf("unknown LogFormat %q, it has to be empty or \"systemd\"", config.LogFormat)}
+	}
+
+	// the IPv4 that FromIPv4 derives the address from is detected with the A config itself
+	if config.A.FromIPv4 != "" {
+		return nil, &ConfigError{Err: errors.New("A.FromIPv4 can't be used, it is only supported for AAAA records")}
+	}
+
+	for _, recordType := range config.RecordTypeOrder {
+		recordConfig := config.recordConfig(recordType)
+		if err := validateFallbackIP(recordType, recordConfig); err != nil {
+			return nil, &ConfigError{Err: err}
+		}
+		if _, err := parseJsonPath(recordConfig.SourcePath); recordConfig.SourcePath != "" && err != nil {
+			return nil, &ConfigError{Err: fmt.Errorf("invalid %s.SourcePath %w", recordType, err)}
+		}
+	}
+
+	for _, selector := range config.ZoneSelectors {
+		if selector.LabelSelector == "" {
+			return nil, &ConfigError{Err: errors.New("ZoneSelectors need a LabelSelector, an empty one would match every zone")}
+		}
+	}
+
+	if config.AdaptiveTTL.Enabled && config.StateFile == "" {
+		return nil, &ConfigError{Err: errors.New("AdaptiveTTL requires a StateFile to remember the address changes")}
+	}
+	if config.AdaptiveTTL.Enabled && (config.AdaptiveTTL.Min < 1 || config.AdaptiveTTL.Min > config.AdaptiveTTL.Max) {
+		return nil, &ConfigError{Err: fmt.Errorf("AdaptiveTTL needs 1 <= Min <= Max, got Min %d and Max %d", config.AdaptiveTTL.Min, config.AdaptiveTTL.Max)}
+	}
+
+	if config.ZonesFile != "" {
+		zonesPath := config.ZonesFile
+		if !filepath.IsAbs(zonesPath) {
+			zonesPath = filepath.Join(filepath.Dir(configPath), zonesPath)
+		}
+
+		zones, err := readZonesFile(zonesPath)
+		if err != nil {
+			return nil, &ConfigError{Err: fmt.Errorf("could not read zones file %w", err)}
+		}
+		if config.Zones == nil {
+			config.Zones = make(map[string]ZoneConfig, len(zones))
+		}
+		for zoneName, zoneConfig := range zones {
+			mergeZone(config.Zones, zoneName, zoneConfig)
+		}
+	}
+
+	if records, ok := os.LookupEnv(recordsEnvVar); ok {
+		zones, err := parseCompactRecords(records)
+		if err != nil {
+			return nil, &ConfigError{Err: fmt.Errorf("invalid %s %w", recordsEnvVar, err)}
+		}
+		if config.Zones == nil {
+			config.Zones = make(map[string]ZoneConfig, len(zones))
+		}
+		for zoneName, zoneConfig := range zones {
+			mergeZone(config.Zones, zoneName, zoneConfig)
+		}
+	}
+
+	if config.LowercaseNames {
+		config.lowercaseNames()
+	}
+
+	return config, nil
+}
+
+// configInclude is the part of a config file that references the file it is based on
+type configInclude struct {
+	Include string `json:"$include"`
+}
+
+// decodeConfigFile decodes the config file into config after the file referenced by its $include,
+// so that the including file overrides the fields of the included one. Relative includes are
+// resolved against the directory of the including file, includeChain holds the files that
+// are currently being included to detect cycles.
+func decodeConfigFile(configPath string, config *DynDnsConfig, includeChain []string) error {
+	absolutePath, err := filepath.Abs(configPath)
+	if err != nil {
+		return fmt.Errorf("could not resolve config file %s %w", configPath, err)
+	}
+	if slices.Contains(includeChain, absolutePath) {
+		return fmt.Errorf("config file %s includes itself via %s", absolutePath, strings.Join(includeChain, " -> "))
+	}
+
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return fmt.Errorf("could not open config file %w", err)
+	}
+
+	include := configInclude{}
+	if err = json.Unmarshal(data, &include); err != nil {
+		return fmt.Errorf("could not parse config file %s %w", configPath, err)
+	}
+
+	if include.Include != "" {
+		includePath := include.Include
+		if !filepath.IsAbs(includePath) {
+			includePath = filepath.Join(filepath.Dir(absolutePath), includePath)
+		}
+		if err = decodeConfigFile(includePath, config, append(includeChain, absolutePath)); err != nil {
+			return err
+		}
+	}
+
+	if err = json.Unmarshal(data, config); err != nil {
+		return fmt.Errorf("could not parse config file %s %w", configPath, err)
+	}
+	return nil
+}
+
+// validateRecordTypeOrder makes sure that the order contains both record types exactly once
+func validateRecordTypeOrder(order []string) error {
+	if len(order) != 2 || !slices.Contains(order, "A") || !slices.Contains(order, "AAAA") {
+		return fmt.Errorf("RecordTypeOrder has to contain A and AAAA exactly once, got %v", order)
+	}
+	return nil
+}
+
+// parseTLSVersion returns the tls version constant for ApiMinTLSVersion, older versions than 1.2 aren't allowed
+func parseTLSVersion(version string) (uint16, error) {
+	switch version {
+	case "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	default:
+		return 0, fmt.Errorf("ApiMinTLSVersion %q has to be either \"1.2\" or \"1.3\"", version)
+	}
+}
+
+// validateFallbackIP makes sure that the fallback address can be used for the record type and normalizes it
+func validateFallbackIP(recordType string, recordConfig *RecordConfig) error {
+	if recordConfig.FallbackIP == "" {
+		return nil
+	}
+
+	ip := net.ParseIP(recordConfig.FallbackIP)
+	if ip == nil || (recordType == "A") == (ip.To4() == nil) {
+		return fmt.Errorf("%s.FallbackIP %q is not a valid address for %s records", recordType, recordConfig.FallbackIP, recordType)
+	} else if recordConfig.SkipIfUnavailable {
+		return fmt.Errorf("%s.FallbackIP can't be combined with SkipIfUnavailable", recordType)
+	}
+	// an IPv4-mapped address is published in its plain form, just like a detected one
+	if recordType == "A" {
+		recordConfig.FallbackIP = ip.To4().String()
+	}
+	return nil
+}
+
+// enforceMinimumTTL replaces a RecordTTL of 0 or less with the default, resolvers treat a ttl of 0 as
+// "don't cache" and the api would use the ttl of the zone as the field is left out of new records
+func (c *DynDnsConfig) enforceMinimumTTL() {
+	if c.RecordTTL > 0 {
+		return
+	}
+	warningLog.Printf("RecordTTL of %d is not allowed, using the default of %d seconds\n", c.RecordTTL, defaultRecordTTL)
+	c.RecordTTL = defaultRecordTTL
+}
+
+// warnAboutSources logs a warning for sources that look like they return an address of the wrong family,
+// which usually means that the sources of A and AAAA have been swapped or share the same url
+func (c *DynDnsConfig) warnAboutSources() {
+	if c.A.Enabled && c.AAAA.Enabled && c.A.Source == c.AAAA.Source && !strings.HasPrefix(c.A.Source, "command:") &&
+		!c.A.ForceFamily && len(c.A.Interfaces) == 0 && len(c.AAAA.Interfaces) == 0 && c.AAAA.FromIPv4 == "" {
+		warningLog.Printf("A and AAAA use the same source %s, set ForceFamily if it answers with the address of the connection\n", c.A.Source)
+	}
+
+	for _, recordType := range c.RecordTypeOrder {
+		recordConfig := c.recordConfig(recordType)
+		if !recordConfig.Enabled || len(recordConfig.Interfaces) > 0 || recordConfig.FromIPv4 != "" {
+			continue
+		}
+		if family := sourceUrlFamily(recordConfig.Source); family != "" && family != recordType {
+			warningLog.Printf("%s.Source %s looks like it returns addresses for %s records\n", recordType, recordConfig.Source, family)
+		}
+	}
+}
+
+// sourceUrlFamily guesses the record type a source url is meant for from an ip literal as its host
+// or a hint like ipv6 in its hostname, it returns an empty string if there is no hint
+func sourceUrlFamily(source string) string {
+	parsed, err := url.Parse(source)
+	if err != nil || parsed.Hostname() == "" {
+		return ""
+	}
+
+	host := strings.ToLower(parsed.Hostname())
+	if ip := net.ParseIP(host); ip != nil {
+		// the connection and therefore usually the detected address can only be of the family of the host
+		if ip.To4() != nil {
+			return "A"
+		}
+		return "AAAA"
+	}
+
+	labels := strings.FieldsFunc(host, func(r rune) bool {
+		return r == '.' || r == '-'
+	})
+	hasV4 := slices.ContainsFunc(labels, func(label string) bool {
+		return label == "ipv4" || label == "v4" || label == "ip4"
+	})
+	hasV6 := slices.ContainsFunc(labels, func(label string) bool {
+		return label == "ipv6" || label == "v6" || label == "ip6"
+	})
+	switch {
+	case hasV4 && !hasV6:
+		return "A"
+	case hasV6 && !hasV4:
+		return "AAAA"
+	default:
+		return ""
+	}
+}
+
+// recordConfig returns the config of the record type
+func (c *DynDnsConfig) recordConfig(recordType string) *RecordConfig {
+	if recordType == "AAAA" {
+		return &c.AAAA
+	}
+	return &c.A
+}
+
+// dumpConfig writes the config with all defaults applied to stdout, the api key is redacted
+func dumpConfig(config *DynDnsConfig) int {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(config); err != nil {
+		errorLog.Println("could not encode config", err)
+		return exitFailed
+	}
+	return 0
+}
+
+// lowercaseNames converts the names of all zones and records to lowercase,
+// zones that only differ in their case are merged
+func (c *DynDnsConfig) lowercaseNames() {
+	zones := make(map[string]ZoneConfig, len(c.Zones))
+	for zoneName, zoneConfig := range c.Zones {
+		for i := range zoneConfig.Records {
+			zoneConfig.Records[i].Name = strings.ToLower(zoneConfig.Records[i].Name)
+		}
+
+		mergeZone(zones, strings.ToLower(zoneName), zoneConfig)
+	}
+	c.Zones = zones
+
+	for _, selector := range c.ZoneSelectors {
+		for i := range selector.Records {
+			selector.Records[i].Name = strings.ToLower(selector.Records[i].Name)
+		}
+	}
+}
+
+// removeDuplicateRecords warns about records that are listed more than once in the same zone, which is
+// likely a copy-paste error, and keeps only the first of them so they aren't updated twice per run.
+// The same record name in different zones is different records and not a duplicate
+func (c *DynDnsConfig) removeDuplicateRecords() {
+	for _, zoneName := range slices.Sorted(maps.Keys(c.Zones)) {
+		zoneConfig := c.Zones[zoneName]
+		seen := map[string]bool{}
+		records := make([]ZoneRecord, 0, len(zoneConfig.Records))
+		for _, record := range zoneConfig.Records {
+			if record.Enabled && seen[record.Name] {
+				warningLog.Printf("record %s is listed more than once in zone %s, only processing it once\n", record.Name, zoneName)
+				continue
+			}
+			seen[record.Name] = seen[record.Name] || record.Enabled
+			records = append(records, record)
+		}
+		zoneConfig.Records = records
+		c.Zones[zoneName] = zoneConfig
+	}
+}
+
+// selectZones adds the records of the ZoneSelectors to the zones of the primary account that match them
+func (c *DynDnsConfig) selectZones() error {
+	if c.Zones == nil {
+		c.Zones = map[string]ZoneConfig{}
+	}
+
+	for _, selector := range c.ZoneSelectors {
+		zoneNames, err := listZones(c.providers()[0], selector.LabelSelector)
+		if err != nil {
+			return err
+		} else if len(zoneNames) == 0 {
+			warningLog.Printf("no zones match the label selector %q\n", selector.LabelSelector)
+		}
+
+		for _, zoneName := range zoneNames {
+			if c.LowercaseNames {
+				zoneName = strings.ToLower(zoneName)
+			}
+			mergeZone(c.Zones, zoneName, ZoneConfig{Enabled: true, Records: slices.Clone(selector.Records)})
+		}
+	}
+	return nil
+}
+
+// filterZones removes all zones and records that don't match the given names, empty names match everything
+// errNoMatchingRecords is returned by filterZones if no record matches the filter
+var errNoMatchingRecords = errors.New("no records match")
+
+func (c *DynDnsConfig) filterZones(zoneName string, recordName string) error {
+	if c.LowercaseNames {
+		zoneName, recordName = strings.ToLower(zoneName), strings.ToLower(recordName)
+	}
+
+	zones := map[string]ZoneConfig{}
+	for name, zoneConfig := range c.Zones {
+		if zoneName != "" && name != zoneName {
+			continue
+		}
+
+		if recordName != "" {
+			zoneConfig.Records = slices.DeleteFunc(slices.Clone(zoneConfig.Records), func(record ZoneRecord) bool {
+				return record.Name != recordName
+			})
+		}
+		if len(zoneConfig.Records) > 0 {
+			zones[name] = zoneConfig
+		}
+	}
+
+	if len(zones) == 0 {
+		return &ConfigError{Err: fmt.Errorf("%w the zone %q and record %q", errNoMatchingRecords, zoneName, recordName)}
+	}
+	c.Zones = zones
+	return nil
+}
+
+// mergeZone adds a zone to zones, if it already exists the records of both are combined
+// and the zone stays only enabled if both are enabled
+func mergeZone(zones map[string]ZoneConfig, zoneName string, zoneConfig ZoneConfig) {
+	if existing, ok := zones[zoneName]; ok {
+		existing.Records = append(existing.Records, zoneConfig.Records...)
+		existing.Enabled = existing.Enabled && zoneConfig.Enabled
+		zoneConfig = existing
+	}
+	zones[zoneName] = zoneConfig
+}
+
+// recordsEnvVar holds additional zones and records in the syntax of parseCompactRecords
+const recordsEnvVar = "DYNDNS_RECORDS"
+
+// parseCompactRecords parses zones and records like "example.com:www,home;other.net:@".
+// Zones are separated by ; and their name is followed by : and their records separated by ,
+func parseCompactRecords(records string) (map[string]ZoneConfig, error) {
+	zones := map[string]ZoneConfig{}
+	for _, zoneDefinition := range strings.Split(records, ";") {
+		if strings.TrimSpace(zoneDefinition) == "" {
+			continue
+		}
+
+		zoneName, recordNames, ok := strings.Cut(zoneDefinition, ":")
+		zoneName = strings.TrimSpace(zoneName)
+		if !ok || zoneName == "" {
+			return nil, fmt.Errorf("%q has to be a zone name followed by : and its records", zoneDefinition)
+		}
+
+		zoneConfig := ZoneConfig{Enabled: true}
+		for _, recordName := range strings.Split(recordNames, ",") {
+			recordName = strings.TrimSpace(recordName)
+			if recordName == "" {
+				return nil, fmt.Errorf("zone %s contains an empty record name", zoneName)
+			}
+			zoneConfig.Records = append(zoneConfig.Records, ZoneRecord{Name: recordName, Enabled: true})
+		}
+		mergeZone(zones, zoneName, zoneConfig)
+	}
+	return zones, nil
+}
+
+// readZonesFile reads a file that contains zones in the same format as DynDnsConfig.Zones
+func readZonesFile(zonesPath string) (map[string]ZoneConfig, error) {
+	data, err := os.ReadFile(zonesPath)
+	if err != nil {
+		return nil, err
+	}
+
+	zones := map[string]ZoneConfig{}
+	if err = json.Unmarshal(data, &zones); err != nil {
+		return nil, fmt.Errorf("could not parse %s %w", zonesPath, err)
+	}
+	return zones, nil
+}
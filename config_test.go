@@ -0,0 +1,80 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// readTestConfig writes the json to a config file and reads it with readConfig
+func readTestConfig(t *testing.T, content string) *DynDnsConfig {
+	t.Helper()
+	configPath := filepath.Join(t.TempDir(), "dyndns.json")
+	if err := os.WriteFile(configPath, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := readConfig(configPath)
+	if err != nil {
+		t.Fatalf("readConfig returned %v", err)
+	}
+	return config
+}
+
+func TestLowercaseNamesMergesZones(t *testing.T) {
+	config := readTestConfig(t, `{"HetznerApiKey": "key", "Zones": {"Example.COM": ["WWW"], "example.com": ["Home"]}}`)
+
+	if len(config.Zones) != 1 {
+		t.Fatalf("zones that only differ in case weren't merged: %v", config.Zones)
+	}
+	zoneConfig, ok := config.Zones["example.com"]
+	if !ok {
+		t.Fatalf("zone name wasn't lowercased: %v", config.Zones)
+	}
+	records := zoneConfig.activeRecords()
+	slices.Sort(records)
+	if !slices.Equal(records, []string{"home", "www"}) {
+		t.Errorf("records of the merged zone are %v, want [home www]", records)
+	}
+}
+
+func TestFilterZonesIgnoresCase(t *testing.T) {
+	config := readTestConfig(t, `{"HetznerApiKey": "key", "Zones": {"Example.COM": ["WWW", "home"], "other.net": ["www"]}}`)
+
+	if err := config.filterZones("EXAMPLE.com", "Www"); err != nil {
+		t.Fatalf("filterZones returned %v", err)
+	}
+	if len(config.Zones) != 1 {
+		t.Fatalf("filterZones kept %v, want only example.com", config.Zones)
+	}
+	zoneConfig := config.Zones["example.com"]
+	if records := zoneConfig.activeRecords(); !slices.Equal(records, []string{"www"}) {
+		t.Errorf("filterZones kept the records %v, want [www]", records)
+	}
+}
+
+// assertConfigError reads the json with readConfig and fails unless it is rejected with a ConfigError
+func assertConfigError(t *testing.T, content string) {
+	t.Helper()
+	configPath := filepath.Join(t.TempDir(), "dyndns.json")
+	if err := os.WriteFile(configPath, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var configErr *ConfigError
+	if _, err := readConfig(configPath); !errors.As(err, &configErr) {
+		t.Errorf("readConfig returned %v for %s, want a ConfigError", err, content)
+	}
+}
+
+func TestAdaptiveTTLBounds(t *testing.T) {
+	for _, bounds := range []string{`"Min": 0, "Max": 3600`, `"Min": 600, "Max": 60`} {
+		assertConfigError(t, `{"HetznerApiKey": "key", "StateFile": "state.json", "AdaptiveTTL": {"Enabled": true, `+bounds+`}}`)
+	}
+}
+
+func TestUnknownLogFormat(t *testing.T) {
+	assertConfigError(t, `{"HetznerApiKey": "key", "LogFormat": "json"}`)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+)
+
+// driftReport lists the records that don't point to the public ip, written by checkDrift
+type driftReport struct {
+	InSync bool
+	// Stale holds the records whose value doesn't match the detected address, including missing ones
+	Stale []driftedRecord
+	// Errors holds the records whose state could not be determined
+	Errors []driftedRecord
+}
+
+type driftedRecord struct {
+	Provider string
+	Zone     string
+	Name     string
+	Type     string
+	Expected string `json:",omitempty"`
+	Current  string `json:",omitempty"`
+	Error    string `json:",omitempty"`
+}
+
+// Exit codes of checkDrift, they follow the plugin api of Nagios instead of the error categories of a run
+const (
+	driftExitStale   = 1
+	driftExitUnknown = 3
+)
+
+// checkDrift compares all records against the public ip without changing anything and writes a json report
+// to stdout. It returns 0 if all records are up-to-date, driftExitStale if any is stale and driftExitUnknown
+// if any couldn't be checked
+func checkDrift(config *DynDnsConfig) int {
+	report := &driftReport{}
+
+	for _, recordType := range config.RecordTypeOrder {
+		recordConfig := config.recordConfig(recordType)
+		if !recordConfig.Enabled {
+			continue
+		}
+
+		ipString, detectErr := detectPublicIP(config, recordType, recordConfig)
+		for _, provider := range config.providers() {
+			for zoneName, zoneConfig := range config.Zones {
+				for _, recordName := range zoneConfig.activeRecords() {
+					record := driftedRecord{Provider: provider.String(), Zone: zoneName, Name: recordName, Type: recordType, Expected: ipString}
+					if detectErr != nil {
+						record.Error = detectErr.Error()
+						report.Errors = append(report.Errors, record)
+						continue
+					}
+
+					current, err := getCurrentRecord(provider, zoneName, recordName, recordType)
+					if err != nil {
+						record.Error = err.Error()
+						report.Errors = append(report.Errors, record)
+					} else if current == nil {
+						report.Stale = append(report.Stale, record)
+					} else if record.Current = current.dynamicValue(config.KeepOtherValues); !recordValuesEqual(recordType, ipString, record.Current) {
+						report.Stale = append(report.Stale, record)
+					}
+				}
+			}
+		}
+	}
+	report.InSync = len(report.Stale) == 0 && len(report.Errors) == 0
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		errorLog.Println("could not write drift report", err)
+	}
+
+	if len(report.Errors) > 0 {
+		return driftExitUnknown
+	} else if len(report.Stale) > 0 {
+		return driftExitStale
+	}
+	return 0
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+)
+
+// printEndpoints prints the api endpoints that are used for every configured record without requesting any of them.
+// Zones that haven't been resolved by ZoneSelectors are requested by their name or id first, the rrsets are then
+// requested with the id from that response, which is printed as {id}
+func printEndpoints(config *DynDnsConfig) int {
+	provider := config.providers()[0]
+	for _, zoneName := range slices.Sorted(maps.Keys(config.Zones)) {
+		zoneConfig := config.Zones[zoneName]
+		zoneEndpoint := fmt.Sprintf("%s/zones/{id}", provider.BaseUrl)
+		if info, ok := provider.zones[zoneName]; ok {
+			zoneEndpoint = fmt.Sprintf("%s/zones/%d", provider.BaseUrl, info.ID)
+		} else {
+			fmt.Println(zoneName)
+			fmt.Println("  GET ", fmt.Sprintf("%s/zones/%s", provider.BaseUrl, zoneName))
+		}
+
+		for _, recordType := range config.RecordTypeOrder {
+			if !config.recordConfig(recordType).Enabled {
+				continue
+			}
+
+			for _, recordName := range zoneConfig.activeRecords() {
+				fmt.Printf("%s.%s %s\n", recordName, zoneName, recordType)
+				fmt.Println("  GET ", rrSetEndpoint(zoneEndpoint, recordName, recordType))
+				fmt.Println("  POST", rrSetsEndpoint(zoneEndpoint))
+				fmt.Println("  POST", rrSetActionEndpoint(zoneEndpoint, recordName, recordType, "set_records"))
+				if config.UpdateTTL || config.AdaptiveTTL.Enabled {
+					fmt.Println("  POST", rrSetActionEndpoint(zoneEndpoint, recordName, recordType, "change_ttl"))
+				}
+			}
+		}
+	}
+	return 0
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"errors"
+)
+
+// ConfigError is returned when the config can't be read or is invalid
+type ConfigError struct {
+	Err error
+}
+
+func (e *ConfigError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ConfigError) Unwrap() error {
+	return e.Err
+}
+
+// NetworkError is returned when a source or the api could not be reached
+type NetworkError struct {
+	Err error
+}
+
+func (e *NetworkError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *NetworkError) Unwrap() error {
+	return e.Err
+}
+
+// Exit codes per error category, every other failure exits with exitFailed
+const (
+	exitFailed  = 1
+	exitConfig  = 2
+	exitNetwork = 3
+	exitAPI     = 4
+)
+
+// exitCode returns the exit code for the category of the error
+func exitCode(err error) int {
+	var configErr *ConfigError
+	var networkErr *NetworkError
+	var apiErr *APIError
+	switch {
+	case errors.As(err, &configErr):
+		return exitConfig
+	case errors.As(err, &networkErr):
+		return exitNetwork
+	case errors.As(err, &apiErr):
+		return exitAPI
+	default:
+		return exitFailed
+	}
+}
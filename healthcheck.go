@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// HealthCheck verifies that a detected address is actually serving before it is published
+type HealthCheck struct {
+	Annotation
+	// Port is connected to with tcp on the detected address
+	Port int
+	// Url is requested with the connection going to the detected address instead of the host of the url,
+	// any 2xx status is healthy. The host is still used for tls and the Host header
+	Url string
+	// Timeout of the whole check, 5 seconds if not set
+	Timeout Duration
+}
+
+const defaultHealthCheckTimeout = 5 * time.Second
+
+func (h *HealthCheck) enabled() bool {
+	return h.Port != 0 || h.Url != ""
+}
+
+// check runs the configured checks against the address and returns the first failure
+func (h *HealthCheck) check(address string) error {
+	timeout := h.Timeout.Duration
+	if timeout <= 0 {
+		timeout = defaultHealthCheckTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	dialer := &net.Dialer{}
+	if h.Port != 0 {
+		conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(address, strconv.Itoa(h.Port)))
+		if err != nil {
+			return fmt.Errorf("could not connect to port %d %w", h.Port, err)
+		}
+		_ = conn.Close()
+	}
+
+	if h.Url != "" {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.Proxy = nil
+		transport.DialContext = func(ctx context.Context, network string, hostPort string) (net.Conn, error) {
+			_, port, err := net.SplitHostPort(hostPort)
+			if err != nil {
+				return nil, err
+			}
+			return dialer.DialContext(ctx, network, net.JoinHostPort(address, port))
+		}
+		defer transport.CloseIdleConnections()
+
+		req, err := http.NewRequestWithContext(ctx, "GET", h.Url, http.NoBody)
+		if err != nil {
+			return err
+		}
+		res, err := (&http.Client{Transport: transport}).Do(req)
+		if err != nil {
+			return fmt.Errorf("could not request %s %w", h.Url, err)
+		}
+		_, _ = io.Copy(io.Discard, io.LimitReader(res.Body, maxSourceResponseSize))
+		_ = res.Body.Close()
+
+		if res.StatusCode < 200 || res.StatusCode > 299 {
+			return fmt.Errorf("%s returned status %d", h.Url, res.StatusCode)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var heartbeatClient = &http.Client{Timeout: 10 * time.Second}
+
+// sendHeartbeat pings the HeartbeatUrl after a successful run, or its /fail variant after a failed run
+// if HeartbeatFail is enabled
+func sendHeartbeat(config *DynDnsConfig, summary *runSummary) {
+	if config.HeartbeatUrl == "" {
+		return
+	}
+
+	url := config.HeartbeatUrl
+	if summary.Failed > 0 {
+		if !config.HeartbeatFail {
+			return
+		}
+		url = strings.TrimSuffix(url, "/") + "/fail"
+	}
+
+	res, err := heartbeatClient.Get(url)
+	if err != nil {
+		errorLog.Println("could not send heartbeat", err)
+		return
+	}
+	defer func(Body io.ReadCloser) {
+		_ = Body.Close()
+	}(res.Body)
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		errorLog.Println("heartbeat returned unexpected status", res.StatusCode)
+	}
+}
@@ -0,0 +1,647 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultApiBaseUrl = "https://api.hetzner.cloud/v1"
+
+// maxApiResponseSize limits how much of a response body is read, rrset responses are only a few kilobytes
+const maxApiResponseSize = 1 << 20
+
+// apiClient is used for all requests to the api, see configureApiClient
+var apiClient = http.DefaultClient
+
+// apiAccept is sent as the Accept header of all api requests, see configureApiClient
+var apiAccept = "application/json"
+
+// configureApiClient creates the apiClient with a transport that keeps connections alive between
+// requests, which prevents connection churn in daemon mode
+func configureApiClient(config *DynDnsConfig) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ForceAttemptHTTP2 = true
+	// readConfig already rejected invalid versions
+	minVersion, _ := parseTLSVersion(config.ApiMinTLSVersion)
+	transport.TLSClientConfig = &tls.Config{MinVersion: minVersion}
+	transport.MaxIdleConns = config.ApiMaxIdleConns
+	transport.MaxIdleConnsPerHost = config.ApiMaxIdleConns
+	transport.IdleConnTimeout = config.ApiIdleTimeout.Duration
+	maxClockSkew = config.MaxClockSkew.Duration
+	apiAccept = config.ApiAccept
+
+	apiClient = &http.Client{
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, _ []*http.Request) error {
+			if req.URL.Scheme != "https" {
+				return fmt.Errorf("refusing to follow redirect of the api to %s", req.URL)
+			}
+			return nil
+		},
+	}
+}
+
+// validateApiBaseUrl makes sure that the api key is never sent without tls
+func validateApiBaseUrl(baseUrl string) error {
+	parsed, err := url.Parse(baseUrl)
+	if err != nil {
+		return fmt.Errorf("invalid api base url %s %w", baseUrl, err)
+	} else if parsed.Scheme != "https" || parsed.Host == "" {
+		return fmt.Errorf("api base url %s has to be an https url", baseUrl)
+	}
+	return nil
+}
+
+// Status codes accepted per api operation. The mutating operations accept the whole 2xx family
+// because the api is not consistent about answering with 200 or 201.
+var (
+	getZoneStatusCodes      = []int{http.StatusOK}
+	getRecordStatusCodes    = []int{http.StatusOK, http.StatusNotFound}
+	createRecordStatusCodes = statusCodeRange(200, 299)
+	updateRecordStatusCodes = statusCodeRange(200, 299)
+	changeTTLStatusCodes    = statusCodeRange(200, 299)
+	deleteRecordStatusCodes = statusCodeRange(200, 299)
+)
+
+func statusCodeRange(from int, to int) []int {
+	codes := make([]int, 0, to-from+1)
+	for code := from; code <= to; code++ {
+		codes = append(codes, code)
+	}
+	return codes
+}
+
+type zoneInfo struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+	// Mode is either primary or secondary, the records of secondary zones are transferred from
+	// another name server and can't be changed via the api
+	Mode string `json:"mode"`
+}
+
+type zoneResponse struct {
+	Zone zoneInfo `json:"zone"`
+}
+
+type zonesResponse struct {
+	Zones []zoneInfo `json:"zones"`
+	Meta  struct {
+		Pagination struct {
+			NextPage int `json:"next_page"`
+		} `json:"pagination"`
+	} `json:"meta"`
+}
+
+// listZones returns the names of all primary zones that match the label selector and remembers them
+func listZones(provider *hetznerProvider, labelSelector string) ([]string, error) {
+	var names []string
+	for page := 1; page != 0; {
+		query := url.Values{"label_selector": {labelSelector}, "page": {strconv.Itoa(page)}, "per_page": {"100"}}
+		endpoint := fmt.Sprintf("%s/zones?%s", provider.BaseUrl, query.Encode())
+		_, body, err := doAuthenticated("GET", provider.ApiKey, endpoint, nil, getZoneStatusCodes, true)
+		if err != nil {
+			return nil, fmt.Errorf("could not list zones matching %s %w", labelSelector, err)
+		}
+
+		parsedResponse := zonesResponse{}
+		if err = json.Unmarshal(body, &parsedResponse); err != nil {
+			return nil, fmt.Errorf("could not parse api response %s %w", body, err)
+		}
+
+		for _, zone := range parsedResponse.Zones {
+			provider.zones[zone.Name] = zone
+			if zone.Mode == "secondary" {
+				warningLog.Printf("zone %s matches the label selector %q but is a secondary zone, skipping it\n", zone.Name, labelSelector)
+				continue
+			}
+			names = append(names, zone.Name)
+		}
+		page = parsedResponse.Meta.Pagination.NextPage
+	}
+	return names, nil
+}
+
+// hetznerProvider is a Hetzner account all records are pushed to
+type hetznerProvider struct {
+	// Name is empty for the primary account
+	Name    string
+	ApiKey  Secret
+	BaseUrl string
+	// zones caches the zones that have been looked up by the name or id they are referenced with in the config
+	zones map[string]zoneInfo
+}
+
+func (p *hetznerProvider) String() string {
+	if p.Name == "" {
+		return "primary"
+	}
+	return p.Name
+}
+
+// logPrefix is put in front of the messages about secondary providers
+func (p *hetznerProvider) logPrefix() string {
+	if p.Name == "" {
+		return ""
+	}
+	return fmt.Sprintf("[%s] ", p.Name)
+}
+
+// providers returns the primary provider followed by all SecondaryProviders
+func (c *DynDnsConfig) providers() []*hetznerProvider {
+	if c.hetznerProviders == nil {
+		c.hetznerProviders = []*hetznerProvider{{ApiKey: c.HetznerApiKey, BaseUrl: c.ApiBaseUrl, zones: map[string]zoneInfo{}}}
+		for _, providerConfig := range c.SecondaryProviders {
+			c.hetznerProviders = append(c.hetznerProviders, &hetznerProvider{
+				Name:    providerConfig.Name,
+				ApiKey:  providerConfig.HetznerApiKey,
+				BaseUrl: c.ApiBaseUrl,
+				zones:   map[string]zoneInfo{},
+			})
+		}
+	}
+	return c.hetznerProviders
+}
+
+// errSecondaryZone is returned for zones whose records can't be changed via the api
+var errSecondaryZone = errors.New("secondary zone")
+
+// getZoneEndpoint returns the api endpoint of a zone that is referenced either by its id or its name.
+// Every zone is looked up once to resolve its id and to make sure that it is a primary zone
+func getZoneEndpoint(provider *hetznerProvider, zone string) (string, error) {
+	info, ok := provider.zones[zone]
+	if !ok {
+		endpoint := fmt.Sprintf("%s/zones/%s", provider.BaseUrl, zone)
+		_, body, err := doAuthenticated("GET", provider.ApiKey, endpoint, nil, getZoneStatusCodes, true)
+		if err != nil {
+			return "", fmt.Errorf("could not resolve zone %s %w", zone, err)
+		}
+
+		parsedResponse := zoneResponse{}
+		err = json.Unmarshal(body, &parsedResponse)
+		if err != nil {
+			return "", fmt.Errorf("could not parse api response %s %w", body, err)
+		}
+
+		info = parsedResponse.Zone
+		provider.zones[zone] = info
+	}
+
+	if info.Mode == "secondary" {
+		return "", fmt.Errorf("%w: zone %s is a secondary zone and cannot be modified", errSecondaryZone, zone)
+	}
+	return fmt.Sprintf("%s/zones/%d", provider.BaseUrl, info.ID), nil
+}
+
+// canWrite reports whether the api key of the provider is allowed to change the zone. It tries to create an
+// rrset without name and type, so nothing is ever changed. The api documents the error code token_readonly
+// (403) for tokens that are "only allowed to perform GET requests", which depends only on the request method
+// and is returned before the body is looked at, forbidden (403) is its general code for insufficient
+// permissions. A key with write access gets to the validation of the body
+// instead, which rejects the empty rrset as invalid_input (400) or with a 422
+func canWrite(provider *hetznerProvider, zoneName string) (bool, error) {
+	zoneEndpoint, err := getZoneEndpoint(provider, zoneName)
+	if err != nil {
+		return false, err
+	}
+
+	_, _, err = doAuthenticated("POST", provider.ApiKey, rrSetsEndpoint(zoneEndpoint), &rrSetPayload{Records: []rrSetRecord{}}, nil, false)
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && (apiErr.Code == "token_readonly" || apiErr.Code == "forbidden") {
+		return false, nil
+	} else if err == nil || isApiStatus(err, http.StatusBadRequest) || isApiStatus(err, http.StatusUnprocessableEntity) {
+		return true, nil
+	}
+	return false, err
+}
+
+// verifyApiKeys warns about api keys that can only read, so that it is noticed before the first update fails
+func (c *DynDnsConfig) verifyApiKeys() {
+	zoneNames := slices.Sorted(maps.Keys(c.Zones))
+	if len(zoneNames) == 0 {
+		return
+	}
+
+	for _, provider := range c.providers() {
+		writable, err := canWrite(provider, zoneNames[0])
+		if err != nil {
+			warningLog.Println(provider.logPrefix()+"could not verify the permissions of the api key", err)
+		} else if !writable {
+			warningLog.Println(provider.logPrefix() + "the api key is read-only, records can't be created or updated with it")
+		}
+	}
+}
+
+func rrSetsEndpoint(zoneEndpoint string) string {
+	return fmt.Sprintf("%s/rrsets", zoneEndpoint)
+}
+
+func rrSetEndpoint(zoneEndpoint string, recordName string, recordType string) string {
+	return fmt.Sprintf("%s/%s/%s", rrSetsEndpoint(zoneEndpoint), recordName, recordType)
+}
+
+func rrSetActionEndpoint(zoneEndpoint string, recordName string, recordType string, action string) string {
+	return fmt.Sprintf("%s/actions/%s", rrSetEndpoint(zoneEndpoint, recordName, recordType), action)
+}
+
+type rrSetResponse struct {
+	RRSet rrSetPayload `json:"rrset"`
+}
+
+type rrSetPayload struct {
+	Name string `json:"name,omitempty"`
+	Type string `json:"type,omitempty"`
+	// TTL is left out when only the records are set, new rrsets always get a ttl because RecordTTL is at least 1
+	TTL     int               `json:"ttl,omitempty"`
+	Labels  map[string]string `json:"labels,omitempty"`
+	Records []rrSetRecord     `json:"records"`
+}
+type rrSetRecord struct {
+	Value   string `json:"value"`
+	Comment string `json:"comment,omitempty"`
+}
+
+// managedByLabel marks the rrsets that have been created by this tool when LabelCreatedRecords is set
+const (
+	managedByLabel = "managed-by"
+	managedByValue = "hetzner_dyndns"
+)
+
+// managedValueComment marks the value of a rrset that is managed by this tool when KeepOtherValues is set
+const managedValueComment = "managed by hetzner_dyndns"
+
+// newManagedRecord returns the record with the value that is managed by this tool
+func newManagedRecord(config *DynDnsConfig, value string) rrSetRecord {
+	record := rrSetRecord{Value: value}
+	if config.KeepOtherValues {
+		record.Comment = managedValueComment
+	}
+	return record
+}
+
+// dynamicValue returns the value that is managed by this tool, which is the first one
+// unless keepOtherValues is set and the value is marked with managedValueComment
+func (p *rrSetPayload) dynamicValue(keepOtherValues bool) string {
+	if !keepOtherValues {
+		return p.firstValue()
+	}
+	for _, record := range p.Records {
+		if record.Comment == managedValueComment {
+			return record.Value
+		}
+	}
+	return ""
+}
+
+// otherRecords returns the records that aren't managed by this tool, which are none unless keepOtherValues is set
+func (p *rrSetPayload) otherRecords(keepOtherValues bool) []rrSetRecord {
+	if p == nil || !keepOtherValues {
+		return nil
+	}
+	var records []rrSetRecord
+	for _, record := range p.Records {
+		if record.Comment != managedValueComment {
+			records = append(records, record)
+		}
+	}
+	return records
+}
+
+// firstValue returns the value of the first record or an empty string if there are none
+func (p *rrSetPayload) firstValue() string {
+	for _, record := range p.Records {
+		return record.Value
+	}
+	return ""
+}
+
+// getCurrentRecord returns the rrset of a record or nil if it doesn't exist.
+// A record can exist without any values, in which case it has to be updated instead of created.
+// The api doesn't send an ETag for rrsets and ignores If-None-Match, so there are no conditional requests,
+// the StateFile is what skips requesting the records while the address doesn't change
+func getCurrentRecord(provider *hetznerProvider, zoneName string, recordName string, recordType string) (*rrSetPayload, error) {
+	zoneEndpoint, err := getZoneEndpoint(provider, zoneName)
+	if err != nil {
+		return nil, err
+	}
+	endpoint := rrSetEndpoint(zoneEndpoint, recordName, recordType)
+
+	statusCode, body, err := doAuthenticated("GET", provider.ApiKey, endpoint, nil, getRecordStatusCodes, true)
+
+	if err != nil {
+		return nil, fmt.Errorf("could not check record existence %w", err)
+	} else if statusCode == http.StatusNotFound {
+		return nil, nil
+	}
+
+	if len(bytes.TrimSpace(body)) == 0 {
+		return nil, fmt.Errorf("api returned an empty response for existing record %s.%s of type %s", recordName, zoneName, recordType)
+	}
+
+	parsedResponse := rrSetResponse{}
+	err = json.Unmarshal(body, &parsedResponse)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse api response %s %w", body, err)
+	}
+
+	if parsedResponse.RRSet.Type == "" {
+		return nil, fmt.Errorf("api response contains no rrset for existing record %s.%s of type %s %s", recordName, zoneName, recordType, body)
+	}
+
+	if !strings.EqualFold(parsedResponse.RRSet.Type, recordType) {
+		warningLog.Printf(provider.logPrefix()+"api returned a rrset of type %s for record %s.%s of type %s, treating it as missing\n", parsedResponse.RRSet.Type, recordName, zoneName, recordType)
+		return nil, nil
+	}
+
+	if len(parsedResponse.RRSet.Records) == 0 {
+		warningLog.Printf(provider.logPrefix()+"record %s.%s of type %s exists but has no values\n", recordName, zoneName, recordType)
+	}
+
+	return &parsedResponse.RRSet, nil
+}
+
+// lookupRetryDelay is waited before a record that could not be requested is requested again
+const lookupRetryDelay = 2 * time.Second
+
+// lookupRecord is getCurrentRecord with up to LookupRetries retries for errors that might be temporary,
+// which are network errors and server errors of the api. A record whose state is unknown is never created
+func lookupRecord(config *DynDnsConfig, provider *hetznerProvider, zoneName string, recordName string, recordType string) (*rrSetPayload, error) {
+	for attempt := 0; ; attempt++ {
+		current, err := getCurrentRecord(provider, zoneName, recordName, recordType)
+		if err == nil || attempt >= config.LookupRetries || !isTemporary(err) {
+			return current, err
+		}
+
+		log.Printf(provider.logPrefix()+"could not request record %s.%s of type %s, retrying in %s %v\n", recordName, zoneName, recordType, lookupRetryDelay, err)
+		time.Sleep(lookupRetryDelay)
+	}
+}
+
+// isTemporary reports whether the error is a network error or a server error of the api
+func isTemporary(err error) bool {
+	var networkErr *NetworkError
+	var apiErr *APIError
+	return errors.As(err, &networkErr) || (errors.As(err, &apiErr) && apiErr.StatusCode >= 500)
+}
+
+// lastMutation is the time the last record has been created or updated
+var lastMutation time.Time
+
+// waitForOperationDelay sleeps until the configured OperationDelay has passed since the last mutation
+func waitForOperationDelay(config *DynDnsConfig) {
+	if config.OperationDelay.Duration <= 0 || lastMutation.IsZero() {
+		return
+	}
+
+	if wait := config.OperationDelay.Duration - time.Since(lastMutation); wait > 0 {
+		time.Sleep(wait)
+	}
+}
+
+func createRecord(config *DynDnsConfig, provider *hetznerProvider, zoneName string, recordName string, recordType string, publicIp string, ttl int) error {
+	if strings.TrimSpace(publicIp) == "" {
+		return fmt.Errorf("refusing to create record %s.%s of type %s with an empty value", recordName, zoneName, recordType)
+	}
+
+	waitForOperationDelay(config)
+	defer func() {
+		lastMutation = time.Now()
+	}()
+
+	log.Printf(provider.logPrefix()+"creating record %s.%s of type %s with %s\n", recordName, zoneName, recordType, publicIp)
+	zoneEndpoint, err := getZoneEndpoint(provider, zoneName)
+	if err != nil {
+		return err
+	}
+	endpoint := rrSetsEndpoint(zoneEndpoint)
+
+	payload := &rrSetPayload{
+		Name:    recordName,
+		Type:    recordType,
+		TTL:     ttl,
+		Records: []rrSetRecord{newManagedRecord(config, publicIp)},
+	}
+	if config.LabelCreatedRecords {
+		payload.Labels = map[string]string{managedByLabel: managedByValue}
+	}
+
+	_, _, err = doAuthenticated("POST", provider.ApiKey, endpoint, payload, createRecordStatusCodes, false)
+
+	if err != nil {
+		return fmt.Errorf("could not create record %s.%s of type %s with %s %w", recordName, zoneName, recordType, publicIp, err)
+	}
+
+	return nil
+}
+
+// updateRecord replaces the values of the record with publicIp, keeping the otherRecords
+func updateRecord(config *DynDnsConfig, provider *hetznerProvider, zoneName string, recordName string, recordType string, publicIp string, otherRecords []rrSetRecord) error {
+	if strings.TrimSpace(publicIp) == "" {
+		return fmt.Errorf("refusing to update record %s.%s of type %s with an empty value", recordName, zoneName, recordType)
+	}
+
+	waitForOperationDelay(config)
+	defer func() {
+		lastMutation = time.Now()
+	}()
+
+	log.Printf(provider.logPrefix()+"updating record %s.%s of type %s with %s\n", recordName, zoneName, recordType, publicIp)
+	zoneEndpoint, err := getZoneEndpoint(provider, zoneName)
+	if err != nil {
+		return err
+	}
+	endpoint := rrSetActionEndpoint(zoneEndpoint, recordName, recordType, "set_records")
+
+	payload := &rrSetPayload{
+		Records: append(slices.Clone(otherRecords), newManagedRecord(config, publicIp)),
+	}
+
+	_, _, err = doAuthenticated("POST", provider.ApiKey, endpoint, payload, updateRecordStatusCodes, false)
+
+	if err != nil {
+		return fmt.Errorf("could not update record %s.%s of type %s with %s %w", recordName, zoneName, recordType, publicIp, err)
+	}
+
+	return nil
+}
+
+// deleteRecord deletes the whole rrset of the record
+func deleteRecord(config *DynDnsConfig, provider *hetznerProvider, zoneName string, recordName string, recordType string) error {
+	waitForOperationDelay(config)
+	defer func() {
+		lastMutation = time.Now()
+	}()
+
+	log.Printf(provider.logPrefix()+"deleting record %s.%s of type %s\n", recordName, zoneName, recordType)
+	zoneEndpoint, err := getZoneEndpoint(provider, zoneName)
+	if err != nil {
+		return err
+	}
+
+	_, _, err = doAuthenticated("DELETE", provider.ApiKey, rrSetEndpoint(zoneEndpoint, recordName, recordType), nil, deleteRecordStatusCodes, false)
+
+	if err != nil {
+		return fmt.Errorf("could not delete record %s.%s of type %s %w", recordName, zoneName, recordType, err)
+	}
+
+	return nil
+}
+
+// removeManagedValue replaces the values of the record with only the otherRecords, which must not be empty
+func removeManagedValue(config *DynDnsConfig, provider *hetznerProvider, zoneName string, recordName string, recordType string, otherRecords []rrSetRecord) error {
+	waitForOperationDelay(config)
+	defer func() {
+		lastMutation = time.Now()
+	}()
+
+	log.Printf(provider.logPrefix()+"removing the managed value of record %s.%s of type %s\n", recordName, zoneName, recordType)
+	zoneEndpoint, err := getZoneEndpoint(provider, zoneName)
+	if err != nil {
+		return err
+	}
+	endpoint := rrSetActionEndpoint(zoneEndpoint, recordName, recordType, "set_records")
+
+	_, _, err = doAuthenticated("POST", provider.ApiKey, endpoint, &rrSetPayload{Records: otherRecords}, updateRecordStatusCodes, false)
+
+	if err != nil {
+		return fmt.Errorf("could not remove the managed value of record %s.%s of type %s %w", recordName, zoneName, recordType, err)
+	}
+
+	return nil
+}
+
+type changeTTLPayload struct {
+	TTL int `json:"ttl"`
+}
+
+func changeRecordTTL(config *DynDnsConfig, provider *hetznerProvider, zoneName string, recordName string, recordType string, ttl int) error {
+	waitForOperationDelay(config)
+	defer func() {
+		lastMutation = time.Now()
+	}()
+
+	log.Printf(provider.logPrefix()+"changing ttl of record %s.%s of type %s to %d\n", recordName, zoneName, recordType, ttl)
+	zoneEndpoint, err := getZoneEndpoint(provider, zoneName)
+	if err != nil {
+		return err
+	}
+	endpoint := rrSetActionEndpoint(zoneEndpoint, recordName, recordType, "change_ttl")
+
+	payload := &changeTTLPayload{
+		TTL: ttl,
+	}
+
+	_, _, err = doAuthenticated("POST", provider.ApiKey, endpoint, payload, changeTTLStatusCodes, false)
+
+	if err != nil {
+		return fmt.Errorf("could not change ttl of record %s.%s of type %s to %d %w", recordName, zoneName, recordType, ttl, err)
+	}
+
+	return nil
+}
+
+func doAuthenticated(method string, apiKey Secret, url string, payload any, expectedStatusCodes []int, readBody bool) (int, []byte, error) {
+	var body io.Reader = http.NoBody
+
+	if payload != nil {
+		encodedPayload, err := json.Marshal(payload)
+		if err != nil {
+			return 0, nil, err
+		}
+		body = bytes.NewBuffer(encodedPayload)
+	}
+
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return 0, nil, err
+	} else if req.URL.Scheme != "https" {
+		return 0, nil, fmt.Errorf("refusing to send api request without tls to %s", url)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if apiAccept != "" {
+		req.Header.Set("Accept", apiAccept)
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", apiKey.Value()))
+
+	response, err := apiClient.Do(req)
+	if err != nil {
+		return 0, nil, &NetworkError{Err: err}
+	}
+	defer func(Body io.ReadCloser) {
+		err := Body.Close()
+		if err != nil {
+			errorLog.Println("could not properly close response body", err)
+		}
+	}(response.Body)
+	checkClockSkew(response)
+
+	if !slices.Contains(expectedStatusCodes, response.StatusCode) {
+		responseBody, _ := io.ReadAll(io.LimitReader(response.Body, maxApiResponseSize))
+		return 0, nil, parseApiError(response.StatusCode, responseBody)
+	}
+	if readBody {
+		responseBody, err := io.ReadAll(io.LimitReader(response.Body, maxApiResponseSize))
+		if err != nil {
+			return 0, nil, err
+		}
+		return response.StatusCode, responseBody, nil
+	}
+
+	return response.StatusCode, nil, nil
+}
+
+// APIError is returned when the api responds with an unexpected status code
+type APIError struct {
+	StatusCode int
+	Code       string
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("unexpected api response %d %s", e.StatusCode, e.Message)
+	}
+	return fmt.Sprintf("%s (code: %s)", e.Message, e.Code)
+}
+
+// isApiStatus reports whether err is caused by an api response with the given status code
+func isApiStatus(err error, statusCode int) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == statusCode
+}
+
+type apiErrorResponse struct {
+	Error struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// parseApiError turns the error object returned by the Hetzner API into an APIError.
+// If the body does not contain such an object the raw body is used as the message instead.
+func parseApiError(statusCode int, body []byte) error {
+	parsedResponse := apiErrorResponse{}
+	if err := json.Unmarshal(body, &parsedResponse); err != nil || parsedResponse.Error.Code == "" {
+		return &APIError{
+			StatusCode: statusCode,
+			Message:    string(body),
+		}
+	}
+
+	return &APIError{
+		StatusCode: statusCode,
+		Code:       parsedResponse.Error.Code,
+		Message:    parsedResponse.Error.Message,
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// newTestProvider starts a fake api with the handler and returns a provider that uses it for the zone example.com
+func newTestProvider(t *testing.T, handler http.HandlerFunc) *hetznerProvider {
+	t.Helper()
+	server := httptest.NewTLSServer(handler)
+	t.Cleanup(server.Close)
+
+	previousClient := apiClient
+	apiClient = server.Client()
+	t.Cleanup(func() {
+		apiClient = previousClient
+	})
+
+	return &hetznerProvider{
+		BaseUrl: server.URL,
+		zones:   map[string]zoneInfo{"example.com": {ID: 1, Name: "example.com", Mode: "primary"}},
+	}
+}
+
+func TestUpdateRecordAcceptsOk(t *testing.T) {
+	var requestedPath string
+	provider := newTestProvider(t, func(w http.ResponseWriter, r *http.Request) {
+		requestedPath = r.URL.Path
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(`{"action":{"id":1,"status":"running"}}`))
+	})
+
+	err := updateRecord(&DynDnsConfig{}, provider, "example.com", "www", "A", "192.0.2.1", nil)
+	if err != nil {
+		t.Fatalf("updateRecord returned %v for a 200 response", err)
+	}
+	if requestedPath != "/zones/1/rrsets/www/A/actions/set_records" {
+		t.Errorf("updateRecord requested %s instead of the set_records action", requestedPath)
+	}
+}
+
+func TestCanWrite(t *testing.T) {
+	tests := []struct {
+		status   int
+		body     string
+		writable bool
+	}{
+		{http.StatusForbidden, `{"error":{"code":"token_readonly","message":"only GET requests are allowed"}}`, false},
+		{http.StatusForbidden, `{"error":{"code":"forbidden","message":"insufficient permissions"}}`, false},
+		{http.StatusBadRequest, `{"error":{"code":"invalid_input","message":"invalid input in field 'name'"}}`, true},
+		{http.StatusUnprocessableEntity, `{"error":{"code":"unprocessable_entity","message":"invalid rrset"}}`, true},
+	}
+	for _, test := range tests {
+		provider := newTestProvider(t, func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(test.status)
+			_, _ = w.Write([]byte(test.body))
+		})
+
+		writable, err := canWrite(provider, "example.com")
+		if err != nil || writable != test.writable {
+			t.Errorf("canWrite returned %t, %v for %s, want %t", writable, err, test.body, test.writable)
+		}
+	}
+
+	provider := newTestProvider(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write([]byte(`{"error":{"code":"resource_limit_exceeded","message":"limit reached"}}`))
+	})
+	if _, err := canWrite(provider, "example.com"); err == nil {
+		t.Error("canWrite didn't return an error for a 403 that isn't about the permissions")
+	}
+}
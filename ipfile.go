@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// writeIPOutputFile writes the addresses detected during the run as TYPE=address lines, which can be
+// sourced by shell scripts. Types without a detected address are left out
+func writeIPOutputFile(outputPath string, config *DynDnsConfig, detected map[string]string) {
+	if outputPath == "" {
+		return
+	}
+
+	var content strings.Builder
+	for _, recordType := range config.RecordTypeOrder {
+		if address, ok := detected[recordType]; ok {
+			_, _ = fmt.Fprintf(&content, "%s=%s\n", recordType, address)
+		}
+	}
+
+	if err := writeFileAtomically(outputPath, []byte(content.String()), 0644); err != nil {
+		errorLog.Println("could not write ip output file", err)
+	}
+}
+
+// writeFileAtomically writes the data to a temporary file next to the path and renames it,
+// so that readers never see a partially written file
+func writeFileAtomically(path string, data []byte, perm os.FileMode) error {
+	temporary, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = os.Remove(temporary.Name())
+	}()
+
+	_, err = temporary.Write(data)
+	if closeErr := temporary.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(temporary.Name(), perm)
+	}
+	if err == nil {
+		err = os.Rename(temporary.Name(), path)
+	}
+	return err
+}
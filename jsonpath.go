@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// jsonPathStep is either a field name or an index of a parsed SourcePath
+type jsonPathStep struct {
+	field string
+	index int
+}
+
+// parseJsonPath parses a path like .data.ip or .addresses[0].value into its steps
+func parseJsonPath(path string) ([]jsonPathStep, error) {
+	if !strings.HasPrefix(path, ".") && !strings.HasPrefix(path, "[") {
+		return nil, fmt.Errorf("path %q has to start with . or [", path)
+	}
+
+	var steps []jsonPathStep
+	for rest := path; rest != ""; {
+		switch rest[0] {
+		case '.':
+			end := strings.IndexAny(rest[1:], ".[") + 1
+			if end == 0 {
+				end = len(rest)
+			}
+			if end == 1 {
+				return nil, fmt.Errorf("path %q contains an empty field name", path)
+			}
+			steps = append(steps, jsonPathStep{field: rest[1:end], index: -1})
+			rest = rest[end:]
+		case '[':
+			end := strings.IndexByte(rest, ']')
+			if end == -1 {
+				return nil, fmt.Errorf("path %q contains an unclosed [", path)
+			}
+			index, err := strconv.Atoi(rest[1:end])
+			if err != nil || index < 0 {
+				return nil, fmt.Errorf("path %q contains the invalid index %q", path, rest[1:end])
+			}
+			steps = append(steps, jsonPathStep{index: index})
+			rest = rest[end+1:]
+		default:
+			return nil, fmt.Errorf("path %q contains unexpected %q", path, rest)
+		}
+	}
+	return steps, nil
+}
+
+// extractJsonPath returns the string at the path in the json document
+func extractJsonPath(document []byte, path string) (string, error) {
+	steps, err := parseJsonPath(path)
+	if err != nil {
+		return "", err
+	}
+
+	var value any
+	if err = json.Unmarshal(document, &value); err != nil {
+		return "", fmt.Errorf("response is not valid json %w", err)
+	}
+
+	for _, step := range steps {
+		if step.index >= 0 {
+			array, ok := value.([]any)
+			if !ok || step.index >= len(array) {
+				return "", fmt.Errorf("response has no element %d at %s", step.index, path)
+			}
+			value = array[step.index]
+		} else {
+			object, ok := value.(map[string]any)
+			if !ok {
+				return "", fmt.Errorf("response has no field %s at %s", step.field, path)
+			}
+			if value, ok = object[step.field]; !ok {
+				return "", fmt.Errorf("response has no field %s at %s", step.field, path)
+			}
+		}
+	}
+
+	text, ok := value.(string)
+	if !ok {
+		return "", fmt.Errorf("value at %s is not a string", path)
+	}
+	return text, nil
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"log"
+	"os"
+	"strings"
+)
+
+// errorLog and warningLog are used for messages with a higher priority than the standard logger
+var (
+	errorLog   = log.Default()
+	warningLog = log.Default()
+)
+
+// configureLogging applies the LogPrefix and LogFormat to all loggers
+func configureLogging(config *DynDnsConfig) {
+	prefix := ""
+	if config.LogPrefix != "" {
+		prefix = config.LogPrefix + " "
+		if strings.Contains(prefix, "{hostname}") {
+			hostname, err := os.Hostname()
+			if err != nil {
+				errorLog.Println("could not get hostname for the log prefix", err)
+			}
+			prefix = strings.ReplaceAll(prefix, "{hostname}", hostname)
+		}
+	}
+
+	flags := log.LstdFlags | log.Lmsgprefix
+	infoPriority, warningPriority, errorPriority := "", "", ""
+	// readConfig only allows an empty LogFormat or "systemd"
+	if config.LogFormat == "systemd" {
+		// the journal adds its own timestamps and needs the priority at the start of the line
+		flags = log.Lmsgprefix
+		infoPriority, warningPriority, errorPriority = "<6>", "<4>", "<3>"
+	}
+
+	log.SetFlags(flags)
+	log.SetPrefix(infoPriority + prefix)
+	warningLog = log.New(log.Writer(), warningPriority+prefix, flags)
+	errorLog = log.New(log.Writer(), errorPriority+prefix, flags)
+}
@@ -1,238 +1,731 @@
 package main
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
+	"errors"
+	"flag"
 	"fmt"
-	"io"
 	"log"
 	"net"
 	"net/http"
 	"os"
+	"path/filepath"
 	"slices"
+	"strings"
+	"time"
 )
 
-type DynDnsConfig struct {
-	HetznerApiKey string
-	RecordTTL     int
-	Zones         map[string][]string
-	A             RecordConfig
-	AAAA          RecordConfig
+// commands that can be given as the first argument, without one the records are updated.
+// They return the exit code instead of exiting, so that every config of a directory is run
+var commands = map[string]func(config *DynDnsConfig) int{
+	"status":          printStatus,
+	"dump-config":     dumpConfig,
+	"print-endpoints": printEndpoints,
+	"check-drift":     checkDrift,
+	"plan":            printPlan,
+	"teardown":        teardown,
+	"bench-sources":   benchSources,
 }
 
-type RecordConfig struct {
-	Enabled bool
-	Source  string
-}
+var (
+	zoneFilter   = flag.String("zone", "", "only process the zone with this name or id")
+	recordFilter = flag.String("record", "", "only process the records with this name")
+	dryRun       = flag.Bool("dry-run", false, "log the changes that would be made without making them")
+	assumeYes    = flag.Bool("yes", false, "delete the records with teardown without asking for confirmation")
+)
 
 func main() {
-	configPath := "dyndns.json"
-	if len(os.Args) >= 2 {
-		configPath = os.Args[1]
+	args := os.Args[1:]
+	var command func(config *DynDnsConfig) int
+	if len(args) >= 1 {
+		if command = commands[args[0]]; command != nil {
+			args = args[1:]
+		}
 	}
 
-	log.Println("using config at", configPath)
-	config := readConfig(configPath)
+	_ = flag.CommandLine.Parse(args)
+	args = flag.Args()
 
-	processRecord(config, "A", &config.A)
-	processRecord(config, "AAAA", &config.AAAA)
-}
+	configPath := "dyndns.json"
+	if len(args) >= 1 {
+		configPath = args[0]
+	}
 
-func readConfig(configPath string) *DynDnsConfig {
-	configFile, err := os.OpenFile(configPath, os.O_RDONLY, 0600)
+	if info, err := os.Stat(configPath); err == nil && info.IsDir() {
+		os.Exit(runConfigDirectory(configPath, command))
+	}
+	os.Exit(runConfigFile(configPath, command, true))
+}
 
-	defer func(configFile *os.File) {
-		err := configFile.Close()
-		if err != nil {
-			log.Println("could not properly close config file", err)
+// runConfigFile runs the command or updates the records of a single config and returns the exit code.
+// Daemon mode is only allowed if it is the only config, otherwise configs without records that match
+// the filter flags are skipped
+func runConfigFile(configPath string, command func(config *DynDnsConfig) int, onlyConfig bool) int {
+	log.Println("using config at", configPath)
+	config, err := readConfig(configPath)
+	if err != nil {
+		errorLog.Println(err)
+		return exitCode(err)
+	}
+	configureLogging(config)
+	config.enforceMinimumTTL()
+	config.warnAboutSources()
+	configureApiClient(config)
+	if len(config.ZoneSelectors) > 0 {
+		if err := config.selectZones(); err != nil {
+			errorLog.Println(err)
+			return exitCode(err)
 		}
-	}(configFile)
+	}
+	config.removeDuplicateRecords()
+	if *zoneFilter != "" || *recordFilter != "" {
+		if err := config.filterZones(*zoneFilter, *recordFilter); err != nil && !onlyConfig && errors.Is(err, errNoMatchingRecords) {
+			log.Println("skipping config", configPath, err)
+			return 0
+		} else if err != nil {
+			errorLog.Println(err)
+			return exitCode(err)
+		}
+	}
 
-	if err != nil {
-		log.Fatalln("could not open config file", err)
+	if command == nil && config.VerifyApiKey && !*dryRun {
+		config.verifyApiKeys()
 	}
 
-	decoder := json.NewDecoder(configFile)
-	config := &DynDnsConfig{
-		RecordTTL: 300,
-		A: RecordConfig{
-			Source: "https://ipv4.seeip.org",
-		},
-		AAAA: RecordConfig{
-			Source: "https://ipv6.seeip.org",
-		},
+	if command != nil {
+		return command(config)
+	} else if config.isDaemon() && !onlyConfig {
+		errorLog.Println("daemon mode is not supported when running all configs of a directory")
+		return exitConfig
+	} else if config.isDaemon() {
+		runDaemon(config)
+	} else if summary := run(context.Background(), config); summary.Failed > 0 {
+		return summary.exitCode()
+	}
+	return 0
+}
+
+// runConfigDirectory runs every *.json config in the directory one after another, files starting with _
+// are skipped so that they can be used for shared settings with $include. The exit code is the one of the
+// first config that failed. DYNDNS_RECORDS is rejected, because it would be merged into every config and
+// update the records with the api key of each of them
+func runConfigDirectory(directory string, command func(config *DynDnsConfig) int) int {
+	if _, ok := os.LookupEnv(recordsEnvVar); ok {
+		err := &ConfigError{Err: fmt.Errorf("%s can't be used when running all configs of a directory", recordsEnvVar)}
+		errorLog.Println(err)
+		return exitCode(err)
 	}
 
-	err = decoder.Decode(config)
+	configPaths, err := filepath.Glob(filepath.Join(directory, "*.json"))
 	if err != nil {
-		log.Fatalln("could not parse config file", err)
+		errorLog.Println("could not list configs", err)
+		return exitConfig
 	}
 
-	return config
+	exitCode := 0
+	for _, configPath := range configPaths {
+		if strings.HasPrefix(filepath.Base(configPath), "_") {
+			continue
+		}
+
+		// every config has its own sources, so nothing detected for the previous config is reused
+		clear(detectedIPs)
+		clear(lastDetectedIPs)
+		configExitCode := runConfigFile(configPath, command, false)
+		if exitCode == 0 {
+			exitCode = configExitCode
+		}
+	}
+	if len(configPaths) == 0 {
+		errorLog.Println("no configs found in", directory)
+		return exitConfig
+	}
+	return exitCode
 }
 
-func processRecord(config *DynDnsConfig, recordType string, recordConfig *RecordConfig) {
-	if !recordConfig.Enabled {
-		return
+// run checks and updates all records once, it stops after the current record when ctx is cancelled
+func run(ctx context.Context, config *DynDnsConfig) *runSummary {
+	summary := &runSummary{}
+	started := time.Now()
+	state := loadState(config.StateFile)
+	for _, recordType := range config.RecordTypeOrder {
+		processRecord(ctx, config, recordType, config.recordConfig(recordType), state, summary)
+	}
+	if !*dryRun {
+		saveState(config.StateFile, state)
 	}
 
-	ipString := getPublicIP(recordConfig)
-	parsedIp := net.ParseIP(ipString)
-	if parsedIp == nil || ((recordType == "A") == (parsedIp.To4() == nil)) {
-		log.Fatalf("service returned invalid ip address %s", ipString)
+	log.Println(summary)
+	writeAuditLog(config, summary)
+	exportTraces(config.OtelEndpoint, started, time.Now(), summary)
+	if !*dryRun {
+		sendHeartbeat(config, summary)
+		writeMetricsFile(config.MetricsFile, summary)
+	}
+	writeResultsFile(config.ResultsFile, summary)
+	writeIPOutputFile(config.IPOutputFile, config, summary.Detected)
+	if config.PrintZoneFile {
+		writeZoneFile(os.Stdout, summary.Records)
 	}
+	return summary
+}
 
-	for zoneName, recordNames := range config.Zones {
-		for _, recordName := range recordNames {
-			if currentAddress := getCurrentRecord(config, zoneName, recordName, recordType); currentAddress == "" {
-				createRecord(config, zoneName, recordName, recordType, ipString)
-			} else {
-				if parsedIp.Equal(net.ParseIP(currentAddress)) {
-					log.Printf("Skipping update of %s.%s with type %s because address is already up-to-date", recordName, zoneName, recordType)
-				} else {
-					updateRecord(config, zoneName, recordName, recordType, ipString)
-				}
-			}
+// lowTTLFactor is how many times the interval has to be larger than the ttl to warn about the ttl
+const lowTTLFactor = 10
+
+// networkSettleDelay is waited after a network change so that the new address is usable before it is checked
+const networkSettleDelay = 5 * time.Second
+
+// runDaemon runs until it receives SIGTERM and checks all records on startup, every interval,
+// on network changes and when it receives SIGUSR1
+func runDaemon(config *DynDnsConfig) {
+	ctx := notifyShutdown(config.ShutdownGracePeriod.Duration)
+	triggers := &daemonTriggers{
+		signals: notifyTriggerSignals(),
+	}
+
+	if config.Interval.Duration != 0 {
+		if config.Interval.Duration < config.MinInterval.Duration {
+			warningLog.Printf("interval %s is below the minimum of %s, using the minimum instead", config.Interval, config.MinInterval)
+			config.Interval = config.MinInterval
+		}
+		log.Println("checking records every", config.Interval)
+		if ttl := time.Duration(config.RecordTTL) * time.Second; !config.AdaptiveTTL.Enabled && ttl*lowTTLFactor <= config.Interval.Duration {
+			warningLog.Printf("RecordTTL of %s is much lower than the interval of %s, resolvers will query the records far more often than they can change, consider raising it\n", ttl, config.Interval)
 		}
+		ticker := time.NewTicker(config.Interval.Duration)
+		defer ticker.Stop()
+		triggers.ticks = ticker.C
 	}
-}
 
-func getPublicIP(recordConfig *RecordConfig) string {
-	res, err := http.Get(recordConfig.Source)
-	if err != nil {
-		log.Fatalf("could not fetch ip from %s %v\n", recordConfig.Source, err)
+	if config.WatchNetwork {
+		changes, err := watchNetworkChanges()
+		if err != nil {
+			errorLog.Fatalln("could not watch for network changes", err)
+		}
+		log.Println("checking records on network changes")
+		triggers.changes = changes
 	}
-	defer func(Body io.ReadCloser) {
-		_ = Body.Close()
-	}(res.Body)
 
-	ip, err := io.ReadAll(res.Body)
-	if err != nil {
-		log.Fatalln("could not read response", err)
+	for ctx.Err() == nil {
+		stopWatchdog := startWatchdog(config.MaxRunDuration.Duration)
+		run(ctx, config)
+		stopWatchdog()
+		triggers.wait(ctx)
 	}
+}
 
-	return string(ip)
+type daemonTriggers struct {
+	ticks   <-chan time.Time
+	changes <-chan struct{}
+	signals <-chan os.Signal
 }
 
-type rrSetResponse struct {
-	RRSet rrSetPayload `json:"rrset"`
+// wait blocks until the next tick, network change or trigger signal or until ctx is cancelled
+func (t *daemonTriggers) wait(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.ticks:
+			return
+		case signal := <-t.signals:
+			log.Println("received", signal, "checking records now")
+			clear(detectedIPs)
+			return
+		case _, ok := <-t.changes:
+			if ok {
+				select {
+				case <-ctx.Done():
+				case <-time.After(networkSettleDelay):
+				}
+				clear(detectedIPs)
+				return
+			}
+
+			warningLog.Println("stopped watching for network changes")
+			t.changes = nil
+			if t.ticks == nil && t.signals == nil {
+				errorLog.Fatalln("no trigger for checking the records left")
+			}
+		}
+	}
 }
 
-type rrSetPayload struct {
-	Name    string        `json:"name,omitempty"`
-	Type    string        `json:"type,omitempty"`
-	TTL     int           `json:"ttl,omitempty"`
-	Records []rrSetRecord `json:"records"`
+// runSummary counts the outcome of every record that has been processed during a run
+type runSummary struct {
+	Checked int
+	Created int
+	Updated int
+	Skipped int
+	Pending int
+	Failed  int
+	// Mismatched lists the record types whose source returned an address of the wrong family
+	Mismatched []string
+	// ProviderFailures counts the failed records per provider
+	ProviderFailures map[string]int
+	// Records holds the state of all records that are known after the run
+	Records []managedRecord
+	// Results holds the outcome of every record that has been processed
+	Results []recordResult
+	// Detected holds the address that has been detected per record type
+	Detected map[string]string
 }
-type rrSetRecord struct {
-	Value string `json:"value"`
+
+type managedRecord struct {
+	Zone  string
+	Name  string
+	Type  string
+	TTL   int
+	Value string
 }
 
-func getCurrentRecord(config *DynDnsConfig, zoneName string, recordName string, recordType string) string {
-	endpoint := fmt.Sprintf("https://api.hetzner.cloud/v1/zones/%s/rrsets/%s/%s", zoneName, recordName, recordType)
+// recordAction is what has been done with a record during a run
+type recordAction string
 
-	statusCode, body, err := doAuthenticated("GET", config.HetznerApiKey, endpoint, nil, []int{200, 404}, true)
+const (
+	actionCreated recordAction = "created"
+	actionUpdated recordAction = "updated"
+	actionSkipped recordAction = "skipped"
+	actionPending recordAction = "pending"
+	actionFailed  recordAction = "failed"
+)
 
-	if err != nil {
-		log.Fatalln("could not check record existence", err)
-	} else if statusCode == 404 {
-		return ""
+// recordResult is the outcome of processing a single record for one provider
+type recordResult struct {
+	Provider *hetznerProvider
+	Zone     string
+	Name     string
+	Type     string
+	Action   recordAction
+	// OldValue is the value before the run, empty if the record didn't exist or couldn't be requested
+	OldValue string
+	// NewValue and TTL are the state of the record after the run, NewValue is empty if it isn't known
+	NewValue string
+	TTL      int
+	Err      error
+	// Simulated is set for the changes of a dry run, which haven't been made
+	Simulated bool
+	// Started and Finished are when the record was processed, they are zero if it hasn't been requested
+	Started  time.Time
+	Finished time.Time
+}
+
+// add counts the result and remembers the state of the record if it is known,
+// only the records of the primary provider are kept
+func (s *runSummary) add(result recordResult) {
+	s.Results = append(s.Results, result)
+	s.Checked++
+	switch result.Action {
+	case actionCreated:
+		s.Created++
+	case actionUpdated:
+		s.Updated++
+	case actionSkipped:
+		s.Skipped++
+	case actionPending:
+		s.Pending++
+	case actionFailed:
+		s.Failed++
+		if s.ProviderFailures == nil {
+			s.ProviderFailures = map[string]int{}
+		}
+		s.ProviderFailures[result.Provider.String()]++
 	}
 
-	parsedResponse := rrSetResponse{}
-	err = json.Unmarshal(body, &parsedResponse)
-	if err != nil {
-		log.Fatalf("could not parse api response %s %v\n", body, err)
+	if result.Provider.Name != "" || result.Action == actionFailed || result.NewValue == "" {
+		return
 	}
+	s.Records = append(s.Records, managedRecord{
+		Zone:  result.Zone,
+		Name:  result.Name,
+		Type:  result.Type,
+		TTL:   result.TTL,
+		Value: result.NewValue,
+	})
+}
 
-	for _, record := range parsedResponse.RRSet.Records {
-		return record.Value
+// exitCode returns the exit code for the category of the first failure, or 0 if nothing failed
+func (s *runSummary) exitCode() int {
+	for _, result := range s.Results {
+		if result.Action == actionFailed {
+			return exitCode(result.Err)
+		}
 	}
+	return 0
+}
 
-	return ""
+func (s *runSummary) String() string {
+	summary := fmt.Sprintf("checked %d records: %d created, %d updated, %d skipped, %d pending, %d failed", s.Checked, s.Created, s.Updated, s.Skipped, s.Pending, s.Failed)
+	if len(s.ProviderFailures) > 1 || (len(s.ProviderFailures) == 1 && s.ProviderFailures["primary"] == 0) {
+		var failures []string
+		for provider, count := range s.ProviderFailures {
+			failures = append(failures, fmt.Sprintf("%s %d", provider, count))
+		}
+		slices.Sort(failures)
+		summary += fmt.Sprintf(" (failed per provider: %s)", strings.Join(failures, ", "))
+	}
+	if len(s.Mismatched) > 0 {
+		summary += fmt.Sprintf(" (address family mismatch for %s)", strings.Join(s.Mismatched, ", "))
+	}
+	return summary
 }
 
-func createRecord(config *DynDnsConfig, zoneName string, recordName string, recordType string, publicIp string) {
-	log.Printf("creating record %s.%s of type %s with %s\n", recordName, zoneName, recordType, publicIp)
-	endpoint := fmt.Sprintf("https://api.hetzner.cloud/v1/zones/%s/rrsets", zoneName)
+// processRecord checks and updates all records of the type, the results are added to the summary and returned.
+// When ctx is cancelled the remaining records are left alone
+func processRecord(ctx context.Context, config *DynDnsConfig, recordType string, recordConfig *RecordConfig, state *runState, summary *runSummary) []recordResult {
+	if !recordConfig.Enabled {
+		return nil
+	}
 
-	payload := &rrSetPayload{
-		Name: recordName,
-		Type: recordType,
-		TTL:  config.RecordTTL,
-		Records: []rrSetRecord{
-			{
-				Value: publicIp,
-			},
-		},
+	recordNames := managedRecordNames(config)
+	if len(recordNames) == 0 {
+		warningLog.Printf("%s records are enabled but no zone has any enabled records, not detecting the address\n", recordType)
+		return nil
 	}
 
-	_, _, err := doAuthenticated("POST", config.HetznerApiKey, endpoint, payload, []int{201}, false)
+	ipString, err := detectPublicIP(config, recordType, recordConfig)
+	if errors.Is(err, errFamilyMismatch) {
+		summary.Mismatched = append(summary.Mismatched, recordType)
+	}
+	if cached, ok := lastDetectedIPs[recordType]; err != nil && ok && config.UseCachedOnDetectFailure && time.Since(cached.At) < config.MaxCachedAge.Duration {
+		warningLog.Printf("could not detect the %s address, using %s that has been detected %s ago %v\n", recordType, cached.Address, time.Since(cached.At).Round(time.Second), err)
+		ipString, err = cached.Address, nil
+	}
+	if err != nil && recordConfig.SkipIfUnavailable && errors.Is(err, errSourceUnavailable) {
+		log.Printf("skipping %s records because no address is available %v\n", recordType, err)
+		return nil
+	} else if err != nil && recordConfig.FallbackIP != "" {
+		warningLog.Printf("could not detect the %s address, using the fallback %s %v\n", recordType, recordConfig.FallbackIP, err)
+		ipString = recordConfig.FallbackIP
+	} else if err != nil {
+		errorLog.Println(err)
+		return summary.addAll(failAll(config, recordType, err))
+	} else {
+		// the fallback isn't observed, it would count as two changes of the address for the adaptive ttl
+		state.observeAddress(recordType, ipString)
+		if summary.Detected == nil {
+			summary.Detected = map[string]string{}
+		}
+		summary.Detected[recordType] = ipString
+	}
 
-	if err != nil {
-		log.Fatalf("could not create record %s.%s of type %s with %s %v\n", recordName, zoneName, recordType, publicIp, err)
+	if recordConfig.HealthCheck.enabled() {
+		if err := recordConfig.HealthCheck.check(ipString); err != nil {
+			warningLog.Printf("not updating %s records because %s failed the health check %v\n", recordType, ipString, err)
+			return nil
+		}
 	}
+
+	ttl := recordTTL(config, state, recordType)
+
+	var confirmChange func() error
+	if recordConfig.ConfirmChange {
+		confirmChange = confirmDetectedIP(config, recordType, recordConfig, ipString)
+	}
+
+	var results []recordResult
+	if config.StateFile != "" && state.unchanged(recordType, ipString, ttl, recordNames) {
+		log.Printf("%s address %s didn't change since the last run, skipping all records\n", recordType, ipString)
+		for _, provider := range config.providers() {
+			for zoneName, zoneConfig := range config.Zones {
+				for _, recordName := range zoneConfig.activeRecords() {
+					results = append(results, recordResult{
+						Provider: provider, Zone: zoneName, Name: recordName, Type: recordType,
+						Action: actionSkipped, OldValue: ipString, NewValue: ipString, TTL: ttl,
+					})
+				}
+			}
+		}
+		return summary.addAll(results)
+	}
+
+	for _, provider := range config.providers() {
+		for zoneName, zoneConfig := range config.Zones {
+			records := zoneConfig.activeRecords()
+			for i, recordName := range records {
+				if ctx.Err() != nil {
+					log.Printf("shutting down, not checking the remaining %s records\n", recordType)
+					return summary.addAll(results)
+				}
+
+				// a paused record is pending so that the address isn't published to the state before it is updated
+				if until := zoneConfig.pausedUntil(recordName); time.Now().Before(until) {
+					log.Printf(provider.logPrefix()+"updating %s.%s with type %s is paused until %s\n", recordName, zoneName, recordType, until.Format(time.RFC3339))
+					results = append(results, recordResult{Provider: provider, Zone: zoneName, Name: recordName, Type: recordType, Action: actionPending})
+					continue
+				}
+
+				started := time.Now()
+				result := processZoneRecord(config, provider, zoneName, recordName, recordType, ipString, ttl, confirmChange)
+				result.Started, result.Finished = started, time.Now()
+				results = append(results, result)
+				// a 404 that is left after the fallbacks means the zone itself doesn't exist, then the
+				// other records of the zone would fail the same way, just like those of a secondary zone
+				if zoneUnusable(result.Err) && i < len(records)-1 {
+					warningLog.Printf(provider.logPrefix()+"zone %s can't be used, skipping its remaining %d %s records\n", zoneName, len(records)-i-1, recordType)
+					for _, skippedName := range records[i+1:] {
+						results = append(results, recordResult{
+							Provider: provider, Zone: zoneName, Name: skippedName, Type: recordType,
+							Action: actionFailed, Err: result.Err,
+						})
+					}
+					break
+				}
+			}
+		}
+	}
+
+	if !slices.ContainsFunc(results, func(result recordResult) bool {
+		return result.Action == actionFailed || result.Action == actionPending
+	}) {
+		state.publish(recordType, ipString, ttl, recordNames)
+	}
+	return summary.addAll(results)
 }
 
-func updateRecord(config *DynDnsConfig, zoneName string, recordName string, recordType string, publicIp string) {
-	log.Printf("updating record %s.%s of type %s with %s\n", recordName, zoneName, recordType, publicIp)
-	endpoint := fmt.Sprintf("https://api.hetzner.cloud/v1/zones/%s/rrsets/%s/%s/actions/set_records", zoneName, recordName, recordType)
+// zoneUnusable reports whether the error means that no record of the zone can be changed
+func zoneUnusable(err error) bool {
+	return isApiStatus(err, http.StatusNotFound) || errors.Is(err, errSecondaryZone)
+}
 
-	payload := &rrSetPayload{
-		Records: []rrSetRecord{
-			{
-				Value: publicIp,
-			},
-		},
+// addAll adds all results to the summary and returns them
+func (s *runSummary) addAll(results []recordResult) []recordResult {
+	for _, result := range results {
+		s.add(result)
 	}
+	return results
+}
 
-	_, _, err := doAuthenticated("POST", config.HetznerApiKey, endpoint, payload, []int{201}, false)
+var errFamilyMismatch = errors.New("address family mismatch")
+
+// detectPublicIP gets the public ip for the record type and makes sure that it is a valid address of the right family
+func detectPublicIP(config *DynDnsConfig, recordType string, recordConfig *RecordConfig) (string, error) {
+	if cached, ok := detectedIPs[recordType]; ok && time.Since(cached.At) < config.MaxIPAge.Duration {
+		return cached.Address, nil
+	}
 
+	started := time.Now()
+	parsedIp, err := getPublicIP(config, recordType, recordConfig)
 	if err != nil {
-		log.Fatalf("could not update record %s.%s of type %s with %s %v\n", recordName, zoneName, recordType, publicIp, err)
+		return "", err
 	}
+	log.Printf("detected %s address %s with %s in %s\n", recordType, parsedIp, sourceLabel(recordConfig), time.Since(started).Round(time.Millisecond))
+
+	// net.IP doesn't tell IPv4-mapped IPv6 addresses like ::ffff:192.0.2.1 apart from IPv4 addresses,
+	// so they are published in their plain IPv4 form for A records and rejected for AAAA records
+	ipv4 := parsedIp.To4()
+	if recordType == "A" && ipv4 == nil {
+		return "", fmt.Errorf("%w: service returned ip address %s which can't be used for A records", errFamilyMismatch, parsedIp)
+	} else if recordType == "A" {
+		parsedIp = ipv4
+	} else if ipv4 != nil {
+		return "", fmt.Errorf("%w: service returned IPv4 or IPv4-mapped address %s which can't be used for %s records", errFamilyMismatch, ipv4, recordType)
+	}
+
+	ipString := parsedIp.String()
+
+	detectedIPs[recordType] = detectedIP{Address: ipString, At: time.Now()}
+	lastDetectedIPs[recordType] = detectedIPs[recordType]
+	return ipString, nil
 }
 
-func doAuthenticated(method string, apiKey string, url string, payload *rrSetPayload, expectedStatusCodes []int, readBody bool) (int, []byte, error) {
-	var body io.Reader = http.NoBody
+// confirmChangeDelay is waited before the address is detected again to confirm a change
+const confirmChangeDelay = 10 * time.Second
+
+// confirmDetectedIP returns a function that detects the address again after confirmChangeDelay and fails
+// if it differs from ipString. The address is only detected again the first time it is called
+func confirmDetectedIP(config *DynDnsConfig, recordType string, recordConfig *RecordConfig, ipString string) func() error {
+	var confirmed bool
+	var confirmErr error
+	return func() error {
+		if confirmed {
+			return confirmErr
+		}
+		confirmed = true
 
-	if payload != nil {
-		encodedPayload, err := json.Marshal(payload)
+		log.Printf("%s address seems to have changed to %s, detecting it again in %s to confirm\n", recordType, ipString, confirmChangeDelay)
+		time.Sleep(confirmChangeDelay)
+		delete(detectedIPs, recordType)
+		confirmedIp, err := detectPublicIP(config, recordType, recordConfig)
 		if err != nil {
-			return 0, nil, err
+			confirmErr = fmt.Errorf("because the change could not be confirmed %w", err)
+		} else if !recordValuesEqual(recordType, ipString, confirmedIp) {
+			confirmErr = fmt.Errorf("because the address changed again to %s while confirming it", confirmedIp)
 		}
-		body = bytes.NewBuffer(encodedPayload)
+		return confirmErr
 	}
+}
 
-	req, err := http.NewRequest(method, url, body)
-	if err != nil {
-		return 0, nil, err
+type detectedIP struct {
+	Address string
+	At      time.Time
+}
+
+// detectedIPs caches the last detected address per record type for MaxIPAge
+var detectedIPs = map[string]detectedIP{}
+
+// lastDetectedIPs holds the last detected address per record type for UseCachedOnDetectFailure,
+// unlike detectedIPs it is kept on network changes and SIGUSR1
+var lastDetectedIPs = map[string]detectedIP{}
+
+// processZoneRecord creates or updates a single record if its value differs from the public ip.
+// If confirmChange is not nil it has to succeed before the value of the record is changed.
+// Failures are logged and returned as part of the result
+func processZoneRecord(config *DynDnsConfig, provider *hetznerProvider, zoneName string, recordName string, recordType string, ipString string, ttl int, confirmChange func() error) recordResult {
+	result := recordResult{Provider: provider, Zone: zoneName, Name: recordName, Type: recordType}
+	fail := func(err error) recordResult {
+		errorLog.Println(provider.logPrefix() + err.Error())
+		result.Action, result.Err = actionFailed, err
+		return result
 	}
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", apiKey))
 
-	response, err := http.DefaultClient.Do(req)
+	current, err := lookupRecord(config, provider, zoneName, recordName, recordType)
+	if err == nil && current == nil && config.CreateGrace.Duration > 0 {
+		log.Printf(provider.logPrefix()+"record %s.%s of type %s doesn't exist, checking again in %s before creating it\n", recordName, zoneName, recordType, config.CreateGrace)
+		time.Sleep(config.CreateGrace.Duration)
+		current, err = lookupRecord(config, provider, zoneName, recordName, recordType)
+	}
 	if err != nil {
-		return 0, nil, err
+		return fail(err)
 	}
-	defer func(Body io.ReadCloser) {
-		err := Body.Close()
-		if err != nil {
-			log.Println("could not properly close response body", err)
+	if current != nil {
+		value := current.dynamicValue(config.KeepOtherValues)
+		result.OldValue, result.NewValue, result.TTL = value, value, current.TTL
+	}
+
+	valueUpToDate := current != nil && recordValuesEqual(recordType, ipString, current.dynamicValue(config.KeepOtherValues))
+	updateTTL := config.UpdateTTL || config.AdaptiveTTL.Enabled
+	ttlUpToDate := current == nil || !updateTTL || ttlWithinTolerance(current.TTL, ttl, config.TTLTolerance)
+
+	if valueUpToDate && ttlUpToDate {
+		log.Printf(provider.logPrefix()+"Skipping update of %s.%s with type %s because address is already up-to-date", recordName, zoneName, recordType)
+		result.Action = actionSkipped
+		return result
+	}
+
+	if !config.UpdateWindows.allows(time.Now()) {
+		log.Printf(provider.logPrefix()+"update of %s.%s with type %s to %s is pending until the next update window\n", recordName, zoneName, recordType, ipString)
+		result.Action = actionPending
+		return result
+	}
+
+	if !valueUpToDate && confirmChange != nil {
+		if err = confirmChange(); err != nil {
+			warningLog.Printf(provider.logPrefix()+"not updating %s.%s with type %s to %s %v\n", recordName, zoneName, recordType, ipString, err)
+			result.Action = actionPending
+			return result
+		}
+	}
+
+	if *dryRun {
+		result.Action, result.Simulated = actionUpdated, true
+		if current == nil {
+			result.Action = actionCreated
+		}
+		if !valueUpToDate {
+			result.NewValue = ipString
+		}
+		if current == nil || !ttlUpToDate {
+			result.TTL = ttl
 		}
-	}(response.Body)
+		log.Printf(provider.logPrefix()+"dry run, not changing record %s.%s of type %s from %q to %s with ttl %d\n", recordName, zoneName, recordType, result.OldValue, result.NewValue, result.TTL)
+		return result
+	}
 
-	if !slices.Contains(expectedStatusCodes, response.StatusCode) {
-		responseBody, _ := io.ReadAll(response.Body)
-		return 0, nil, fmt.Errorf("unexpected api response %d %s", response.StatusCode, string(responseBody))
+	if current == nil {
+		err = createRecord(config, provider, zoneName, recordName, recordType, ipString, ttl)
+		if !isApiStatus(err, http.StatusConflict) {
+			if err != nil {
+				return fail(err)
+			}
+			result.Action, result.NewValue, result.TTL = actionCreated, ipString, ttl
+			return result
+		}
+
+		log.Printf(provider.logPrefix()+"record %s.%s of type %s has been created in the meantime, updating it instead\n", recordName, zoneName, recordType)
+		if current, err = getCurrentRecord(provider, zoneName, recordName, recordType); err != nil {
+			return fail(err)
+		} else if current == nil {
+			return fail(fmt.Errorf("record %s.%s of type %s could not be created because it already exists, but it could not be found either", recordName, zoneName, recordType))
+		}
+		if err = updateRecord(config, provider, zoneName, recordName, recordType, ipString, current.otherRecords(config.KeepOtherValues)); err != nil {
+			return fail(err)
+		}
+		result.Action, result.OldValue, result.NewValue, result.TTL = actionUpdated, current.dynamicValue(config.KeepOtherValues), ipString, current.TTL
+		return result
 	}
-	if readBody {
-		responseBody, err := io.ReadAll(response.Body)
+
+	// the value and the ttl are changed with separate actions and only if they differ, the api has no
+	// request that replaces both at once because an update of the rrset itself only changes its labels
+	if !valueUpToDate {
+		err = updateRecord(config, provider, zoneName, recordName, recordType, ipString, current.otherRecords(config.KeepOtherValues))
+		if isApiStatus(err, http.StatusNotFound) {
+			log.Printf(provider.logPrefix()+"record %s.%s of type %s has been deleted in the meantime, creating it instead\n", recordName, zoneName, recordType)
+			err = createRecord(config, provider, zoneName, recordName, recordType, ipString, ttl)
+		}
 		if err != nil {
-			return 0, nil, err
+			return fail(err)
+		}
+		result.NewValue = ipString
+	}
+	if !ttlUpToDate {
+		if err = changeRecordTTL(config, provider, zoneName, recordName, recordType, ttl); err != nil {
+			return fail(err)
+		}
+		result.TTL = ttl
+	}
+
+	result.Action = actionUpdated
+	return result
+}
+
+// ttlWithinTolerance reports whether the current ttl differs from the configured one by at most tolerance seconds
+func ttlWithinTolerance(current int, configured int, tolerance int) bool {
+	difference := current - configured
+	if difference < 0 {
+		difference = -difference
+	}
+	return difference <= tolerance
+}
+
+// failAll returns a failed result for every configured record, used when no address could be determined
+func failAll(config *DynDnsConfig, recordType string, err error) []recordResult {
+	var results []recordResult
+	for _, provider := range config.providers() {
+		for zoneName, zoneConfig := range config.Zones {
+			for _, recordName := range zoneConfig.activeRecords() {
+				results = append(results, recordResult{
+					Provider: provider, Zone: zoneName, Name: recordName, Type: recordType,
+					Action: actionFailed, Err: err,
+				})
+			}
 		}
-		return response.StatusCode, responseBody, nil
 	}
+	return results
+}
 
-	return response.StatusCode, nil, nil
+// recordValuesEqual compares two values of a record. Addresses are compared by their parsed value,
+// all other values are compared after normalizing them with normalizeRecordValue
+func recordValuesEqual(recordType string, a string, b string) bool {
+	if recordType == "A" || recordType == "AAAA" {
+		parsedA, parsedB := net.ParseIP(a), net.ParseIP(b)
+		return parsedA != nil && parsedA.Equal(parsedB)
+	}
+
+	return normalizeRecordValue(a) == normalizeRecordValue(b)
+}
+
+// normalizeRecordValue removes the trailing dot of fully qualified names, which the api
+// returns or omits depending on the record type
+func normalizeRecordValue(value string) string {
+	return strings.TrimSuffix(value, ".")
+}
+
+// truncate shortens s to at most length bytes
+func truncate(s string, length int) string {
+	if len(s) <= length {
+		return s
+	}
+	return s[:length] + "..."
 }
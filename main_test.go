@@ -0,0 +1,153 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRecordValuesEqual(t *testing.T) {
+	tests := []struct {
+		recordType string
+		a          string
+		b          string
+		equal      bool
+	}{
+		{"A", "192.0.2.1", "192.0.2.1", true},
+		{"A", "192.0.2.1", "192.0.2.2", false},
+		{"A", "192.0.2.1", "", false},
+		{"A", "not an ip", "not an ip", false},
+		{"AAAA", "2001:db8::1", "2001:0db8:0000::0001", true},
+		{"AAAA", "2001:db8::1", "2001:db8::2", false},
+		{"CNAME", "target.example.com.", "target.example.com", true},
+		{"CNAME", "target.example.com", "target.example.com", true},
+		{"CNAME", "target.example.com.", "other.example.com.", false},
+		{"MX", "10 mail.example.com.", "10 mail.example.com", true},
+		{"MX", "10 mail.example.com.", "20 mail.example.com.", false},
+	}
+
+	for _, test := range tests {
+		if equal := recordValuesEqual(test.recordType, test.a, test.b); equal != test.equal {
+			t.Errorf("recordValuesEqual(%s, %q, %q) = %v, want %v", test.recordType, test.a, test.b, equal, test.equal)
+		}
+	}
+}
+
+func TestDetectPublicIPMappedAddress(t *testing.T) {
+	tests := []struct {
+		recordType string
+		output     string
+		want       string
+		mismatch   bool
+	}{
+		{"A", "::ffff:192.0.2.1", "192.0.2.1", false},
+		{"A", "192.0.2.1", "192.0.2.1", false},
+		{"AAAA", "::ffff:192.0.2.1", "", true},
+		{"AAAA", "2001:db8::1", "2001:db8::1", false},
+		{"A", "2001:db8::1", "", true},
+	}
+
+	for _, test := range tests {
+		clear(detectedIPs)
+		recordConfig := &RecordConfig{Source: "command:echo " + test.output}
+		ip, err := detectPublicIP(&DynDnsConfig{}, test.recordType, recordConfig)
+		if test.mismatch {
+			if !errors.Is(err, errFamilyMismatch) {
+				t.Errorf("detectPublicIP(%s, %s) returned %q %v, want errFamilyMismatch", test.recordType, test.output, ip, err)
+			}
+		} else if err != nil || ip != test.want {
+			t.Errorf("detectPublicIP(%s, %s) returned %q %v, want %s", test.recordType, test.output, ip, err, test.want)
+		}
+	}
+	clear(detectedIPs)
+}
+
+func TestValidateFallbackIPMappedAddress(t *testing.T) {
+	recordConfig := &RecordConfig{FallbackIP: "::ffff:192.0.2.1"}
+	if err := validateFallbackIP("A", recordConfig); err != nil {
+		t.Fatalf("validateFallbackIP returned %v", err)
+	} else if recordConfig.FallbackIP != "192.0.2.1" {
+		t.Errorf("FallbackIP is %q after validating, want 192.0.2.1", recordConfig.FallbackIP)
+	}
+
+	if err := validateFallbackIP("AAAA", &RecordConfig{FallbackIP: "::ffff:192.0.2.1"}); err == nil {
+		t.Error("validateFallbackIP accepted an IPv4-mapped address for AAAA records")
+	}
+}
+
+// conflictingApi fakes an api on which the record is created by someone else between the lookup and the create request,
+// afterwards it returns existing for the record
+func conflictingApi(existing string) http.HandlerFunc {
+	var looked bool
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "GET" && !looked:
+			looked = true
+			w.WriteHeader(http.StatusNotFound)
+		case r.Method == "GET" && existing == "":
+			w.WriteHeader(http.StatusNotFound)
+		case r.Method == "GET":
+			_, _ = w.Write([]byte(`{"rrset":{"name":"www","type":"A","ttl":300,"records":[{"value":"` + existing + `"}]}}`))
+		case r.URL.Path == "/zones/1/rrsets":
+			w.WriteHeader(http.StatusConflict)
+			_, _ = w.Write([]byte(`{"error":{"code":"uniqueness_error","message":"rrset already exists"}}`))
+		default:
+			_, _ = w.Write([]byte(`{"action":{"id":1,"status":"running"}}`))
+		}
+	}
+}
+
+func TestProcessZoneRecordUpdatesAfterConflict(t *testing.T) {
+	provider := newTestProvider(t, conflictingApi("192.0.2.2"))
+
+	result := processZoneRecord(&DynDnsConfig{}, provider, "example.com", "www", "A", "192.0.2.1", 60, nil)
+	if result.Err != nil {
+		t.Fatalf("processZoneRecord failed after a conflict %v", result.Err)
+	}
+	if result.Action != actionUpdated || result.OldValue != "192.0.2.2" || result.NewValue != "192.0.2.1" || result.TTL != 300 {
+		t.Errorf("processZoneRecord returned %s from %q to %q with ttl %d, want updated from 192.0.2.2 to 192.0.2.1 with ttl 300",
+			result.Action, result.OldValue, result.NewValue, result.TTL)
+	}
+}
+
+func TestProcessZoneRecordFailsAfterConflictWithoutRecord(t *testing.T) {
+	provider := newTestProvider(t, conflictingApi(""))
+
+	result := processZoneRecord(&DynDnsConfig{}, provider, "example.com", "www", "A", "192.0.2.1", 60, nil)
+	if result.Action != actionFailed || result.Err == nil {
+		t.Errorf("processZoneRecord returned %s with error %v when the conflicting record can't be found", result.Action, result.Err)
+	}
+}
+
+func TestRunConfigDirectoryRunsEveryConfig(t *testing.T) {
+	directory := t.TempDir()
+	for _, name := range []string{"a.json", "b.json"} {
+		if err := os.WriteFile(filepath.Join(directory, name), []byte(`{"HetznerApiKey": "key"}`), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var runs int
+	code := runConfigDirectory(directory, func(config *DynDnsConfig) int {
+		runs++
+		return driftExitStale
+	})
+	if runs != 2 || code != driftExitStale {
+		t.Errorf("runConfigDirectory ran the command %d times and returned %d, want 2 runs and %d", runs, code, driftExitStale)
+	}
+}
+
+func TestRunConfigDirectoryRejectsRecordsEnvVar(t *testing.T) {
+	t.Setenv(recordsEnvVar, "example.com:www")
+
+	var runs int
+	code := runConfigDirectory(t.TempDir(), func(config *DynDnsConfig) int {
+		runs++
+		return 0
+	})
+	if runs != 0 || code != exitConfig {
+		t.Errorf("runConfigDirectory ran the command %d times and returned %d with %s set, want no runs and %d", runs, code, recordsEnvVar, exitConfig)
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// writeMetricsFile writes the summary of the run in the Prometheus text format for the textfile collector
+// of the node_exporter
+func writeMetricsFile(metricsPath string, summary *runSummary) {
+	if metricsPath == "" {
+		return
+	}
+
+	var buffer bytes.Buffer
+	writeMetric(&buffer, "hetzner_dyndns_last_run_timestamp_seconds", "Unix time of the last run.", time.Now().Unix())
+	writeMetric(&buffer, "hetzner_dyndns_records_checked", "Records checked in the last run.", summary.Checked)
+	writeMetric(&buffer, "hetzner_dyndns_records_created", "Records created in the last run.", summary.Created)
+	writeMetric(&buffer, "hetzner_dyndns_records_updated", "Records updated in the last run.", summary.Updated)
+	writeMetric(&buffer, "hetzner_dyndns_records_skipped", "Records already up-to-date in the last run.", summary.Skipped)
+	writeMetric(&buffer, "hetzner_dyndns_records_pending", "Records waiting for an update window in the last run.", summary.Pending)
+	writeMetric(&buffer, "hetzner_dyndns_records_failed", "Records that could not be updated in the last run.", summary.Failed)
+
+	if len(summary.ProviderFailures) > 0 {
+		fmt.Fprintln(&buffer, "# HELP hetzner_dyndns_provider_records_failed Records that could not be updated in the last run per provider.")
+		fmt.Fprintln(&buffer, "# TYPE hetzner_dyndns_provider_records_failed gauge")
+		providers := make([]string, 0, len(summary.ProviderFailures))
+		for provider := range summary.ProviderFailures {
+			providers = append(providers, provider)
+		}
+		slices.Sort(providers)
+		for _, provider := range providers {
+			fmt.Fprintf(&buffer, "hetzner_dyndns_provider_records_failed{provider=%q} %d\n", provider, summary.ProviderFailures[provider])
+		}
+	}
+
+	// readable by everyone because the collector usually runs as another user
+	if err := writeFileAtomically(metricsPath, buffer.Bytes(), 0644); err != nil {
+		errorLog.Println("could not write metrics file", err)
+	}
+}
+
+func writeMetric[T int | int64](buffer *bytes.Buffer, name string, help string, value T) {
+	fmt.Fprintf(buffer, "# HELP %s %s\n# TYPE %s gauge\n%s %d\n", name, help, name, name, value)
+}
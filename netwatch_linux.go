@@ -0,0 +1,60 @@
+package main
+
+import (
+	"syscall"
+)
+
+// watchNetworkChanges subscribes to the address notifications of the kernel via netlink.
+// The returned channel receives a value whenever an address is added to or removed from an interface,
+// multiple changes that happen while the previous one hasn't been consumed yet are coalesced
+func watchNetworkChanges() (<-chan struct{}, error) {
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_RAW|syscall.SOCK_CLOEXEC, syscall.NETLINK_ROUTE)
+	if err != nil {
+		return nil, err
+	}
+
+	address := &syscall.SockaddrNetlink{
+		Family: syscall.AF_NETLINK,
+		Groups: 1<<(syscall.RTNLGRP_IPV4_IFADDR-1) | 1<<(syscall.RTNLGRP_IPV6_IFADDR-1),
+	}
+	if err = syscall.Bind(fd, address); err != nil {
+		_ = syscall.Close(fd)
+		return nil, err
+	}
+
+	changes := make(chan struct{}, 1)
+	go func() {
+		defer close(changes)
+		defer func() {
+			_ = syscall.Close(fd)
+		}()
+
+		buffer := make([]byte, syscall.Getpagesize())
+		for {
+			n, _, err := syscall.Recvfrom(fd, buffer, 0)
+			if err == syscall.EINTR {
+				continue
+			} else if err != nil {
+				errorLog.Println("could not receive network changes", err)
+				return
+			}
+
+			messages, err := syscall.ParseNetlinkMessage(buffer[:n])
+			if err != nil {
+				errorLog.Println("could not parse network change", err)
+				continue
+			}
+
+			for _, message := range messages {
+				if message.Header.Type == syscall.RTM_NEWADDR || message.Header.Type == syscall.RTM_DELADDR {
+					select {
+					case changes <- struct{}{}:
+					default:
+					}
+				}
+			}
+		}
+	}()
+
+	return changes, nil
+}
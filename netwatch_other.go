@@ -0,0 +1,9 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+func watchNetworkChanges() (<-chan struct{}, error) {
+	return nil, errors.New("watching for network changes is only supported on linux")
+}
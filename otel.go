@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var otelClient = &http.Client{Timeout: 10 * time.Second}
+
+// otlp span status codes
+const (
+	otelStatusOk    = 1
+	otelStatusError = 2
+)
+
+type otelAttribute struct {
+	Key   string `json:"key"`
+	Value struct {
+		StringValue string `json:"stringValue"`
+	} `json:"value"`
+}
+
+type otelSpan struct {
+	TraceId           string          `json:"traceId"`
+	SpanId            string          `json:"spanId"`
+	ParentSpanId      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otelAttribute `json:"attributes"`
+	Status            struct {
+		Code    int    `json:"code"`
+		Message string `json:"message,omitempty"`
+	} `json:"status"`
+}
+
+// exportTraces sends the run and each of its records as spans of one trace to the OTLP/HTTP endpoint
+// of a collector, using the json encoding so that no protobuf library is needed
+func exportTraces(endpoint string, started time.Time, finished time.Time, summary *runSummary) {
+	if endpoint == "" {
+		return
+	}
+
+	traceId := randomHex(16)
+	runSpan := newOtelSpan(traceId, "", "run", started, finished,
+		"dyndns.checked", strconv.Itoa(summary.Checked), "dyndns.failed", strconv.Itoa(summary.Failed))
+	if summary.Failed > 0 {
+		runSpan.Status.Code = otelStatusError
+	}
+	spans := []otelSpan{runSpan}
+	for _, result := range summary.Results {
+		// records that haven't been requested, e.g. because the address didn't change, take no time
+		start, end := result.Started, result.Finished
+		if start.IsZero() {
+			start, end = finished, finished
+		}
+		span := newOtelSpan(traceId, runSpan.SpanId, "record", start, end,
+			"dyndns.provider", result.Provider.String(), "dns.zone", result.Zone, "dns.record", result.Name,
+			"dns.type", result.Type, "dyndns.action", string(result.Action))
+		if result.Err != nil {
+			span.Status.Code, span.Status.Message = otelStatusError, result.Err.Error()
+		}
+		spans = append(spans, span)
+	}
+
+	body, err := json.Marshal(map[string]any{
+		"resourceSpans": []any{map[string]any{
+			"resource": map[string]any{"attributes": []otelAttribute{newOtelAttribute("service.name", "hetzner_dyndns")}},
+			"scopeSpans": []any{map[string]any{
+				"scope": map[string]string{"name": "hetzner_dyndns"},
+				"spans": spans,
+			}},
+		}},
+	})
+	if err != nil {
+		errorLog.Println("could not encode traces", err)
+		return
+	}
+
+	url := strings.TrimSuffix(endpoint, "/")
+	if !strings.HasSuffix(url, "/v1/traces") {
+		url += "/v1/traces"
+	}
+	res, err := otelClient.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		errorLog.Println("could not export traces", err)
+		return
+	}
+	defer func(Body io.ReadCloser) {
+		_ = Body.Close()
+	}(res.Body)
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		errorLog.Println("trace export returned unexpected status", res.StatusCode)
+	}
+}
+
+// newOtelSpan creates an internal span with the attributes given as key value pairs
+func newOtelSpan(traceId string, parentSpanId string, name string, start time.Time, end time.Time, attributes ...string) otelSpan {
+	span := otelSpan{
+		TraceId:           traceId,
+		SpanId:            randomHex(8),
+		ParentSpanId:      parentSpanId,
+		Name:              name,
+		Kind:              1,
+		StartTimeUnixNano: strconv.FormatInt(start.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(end.UnixNano(), 10),
+	}
+	for i := 0; i+1 < len(attributes); i += 2 {
+		span.Attributes = append(span.Attributes, newOtelAttribute(attributes[i], attributes[i+1]))
+	}
+	span.Status.Code = otelStatusOk
+	return span
+}
+
+func newOtelAttribute(key string, value string) otelAttribute {
+	attribute := otelAttribute{Key: key}
+	attribute.Value.StringValue = value
+	return attribute
+}
+
+func randomHex(length int) string {
+	id := make([]byte, length)
+	_, _ = rand.Read(id)
+	return hex.EncodeToString(id)
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// ANSI escape sequences used for the plan, they are left out if stdout is not a terminal or NO_COLOR is set
+type planColors struct {
+	create, remove, change, reset string
+}
+
+func newPlanColors() planColors {
+	if _, noColor := os.LookupEnv("NO_COLOR"); noColor {
+		return planColors{}
+	}
+	if info, err := os.Stdout.Stat(); err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return planColors{}
+	}
+	return planColors{create: "\033[32m", remove: "\033[31m", change: "\033[33m", reset: "\033[0m"}
+}
+
+// printPlan prints the changes that a run would make to every configured record without changing anything,
+// similar to the plan of terraform
+func printPlan(config *DynDnsConfig) int {
+	colors := newPlanColors()
+	state := loadState(config.StateFile)
+	create, update, unchanged, failed := 0, 0, 0, 0
+
+	for _, recordType := range config.RecordTypeOrder {
+		recordConfig := config.recordConfig(recordType)
+		if !recordConfig.Enabled {
+			continue
+		}
+
+		ipString, err := detectPublicIP(config, recordType, recordConfig)
+		if err != nil {
+			errorLog.Println(err)
+			continue
+		}
+		ttl := recordTTL(config, state, recordType)
+		updateTTL := config.UpdateTTL || config.AdaptiveTTL.Enabled
+
+		for _, provider := range config.providers() {
+			for zoneName, zoneConfig := range config.Zones {
+				for _, recordName := range zoneConfig.activeRecords() {
+					name := fmt.Sprintf("%s%s.%s %s", provider.logPrefix(), recordName, zoneName, recordType)
+
+					current, err := getCurrentRecord(provider, zoneName, recordName, recordType)
+					if err != nil {
+						errorLog.Println(provider.logPrefix() + err.Error())
+						failed++
+						continue
+					}
+
+					if current == nil {
+						fmt.Printf("%s  + %s%s\n", colors.create, name, colors.reset)
+						fmt.Printf("%s      + %s (ttl %d)%s\n", colors.create, ipString, ttl, colors.reset)
+						create++
+						continue
+					}
+
+					value := current.dynamicValue(config.KeepOtherValues)
+					valueChanged := !recordValuesEqual(recordType, ipString, value)
+					ttlChanged := updateTTL && !ttlWithinTolerance(current.TTL, ttl, config.TTLTolerance)
+					if !valueChanged && !ttlChanged {
+						fmt.Printf("    %s %s\n", name, value)
+						unchanged++
+						continue
+					}
+
+					fmt.Printf("%s  ~ %s%s\n", colors.change, name, colors.reset)
+					if valueChanged {
+						if value != "" {
+							fmt.Printf("%s      - %s%s\n", colors.remove, value, colors.reset)
+						}
+						fmt.Printf("%s      + %s%s\n", colors.create, ipString, colors.reset)
+					}
+					if ttlChanged {
+						fmt.Printf("%s      ~ ttl %d -> %d%s\n", colors.change, current.TTL, ttl, colors.reset)
+					}
+					update++
+				}
+			}
+		}
+	}
+
+	fmt.Printf("\nPlan: %d to create, %d to update, %d unchanged", create, update, unchanged)
+	if failed > 0 {
+		fmt.Printf(", %d could not be checked", failed)
+	}
+	fmt.Println()
+	return 0
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// resultsFile is the content of the ResultsFile, a snapshot of the last run
+type resultsFile struct {
+	Time     time.Time
+	DryRun   bool `json:",omitempty"`
+	Checked  int
+	Failed   int
+	Detected map[string]string
+	Records  []resultsFileRecord
+}
+
+type resultsFileRecord struct {
+	Provider string
+	Zone     string
+	Name     string
+	Type     string
+	Action   recordAction
+	OldValue string `json:",omitempty"`
+	NewValue string `json:",omitempty"`
+	TTL      int    `json:",omitempty"`
+	Error    string `json:",omitempty"`
+}
+
+// writeResultsFile replaces the ResultsFile with the action of every record and the detected addresses of the run,
+// for automation that reacts to the changes. Unlike the AuditFile it only ever holds the last run
+func writeResultsFile(resultsPath string, summary *runSummary) {
+	if resultsPath == "" {
+		return
+	}
+
+	results := resultsFile{
+		Time:     time.Now(),
+		DryRun:   *dryRun,
+		Checked:  summary.Checked,
+		Failed:   summary.Failed,
+		Detected: summary.Detected,
+		Records:  make([]resultsFileRecord, 0, len(summary.Results)),
+	}
+	for _, result := range summary.Results {
+		record := resultsFileRecord{
+			Provider: result.Provider.String(),
+			Zone:     result.Zone,
+			Name:     result.Name,
+			Type:     result.Type,
+			Action:   result.Action,
+			OldValue: result.OldValue,
+			NewValue: result.NewValue,
+			TTL:      result.TTL,
+		}
+		if result.Err != nil {
+			record.Error = result.Err.Error()
+		}
+		results.Records = append(results.Records, record)
+	}
+
+	data, err := json.MarshalIndent(results, "", "  ")
+	if err != nil {
+		errorLog.Println("could not encode results", err)
+		return
+	}
+	if err = writeFileAtomically(resultsPath, append(data, '\n'), 0644); err != nil {
+		errorLog.Println("could not write results file", err)
+	}
+}
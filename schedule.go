@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// UpdateWindow is a time range on some days in which records may be changed.
+// If From is after To the window ends on the next day, if both are equal it is empty
+type UpdateWindow struct {
+	// Days the window starts on, every day if empty
+	Days []Weekday
+	From ClockTime
+	To   ClockTime
+}
+
+type UpdateWindows []UpdateWindow
+
+// allows reports whether t is in any of the windows, which is always the case without windows
+func (w UpdateWindows) allows(t time.Time) bool {
+	if len(w) == 0 {
+		return true
+	}
+
+	for _, window := range w {
+		if window.contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *UpdateWindow) contains(t time.Time) bool {
+	now := ClockTime(t.Hour()*60 + t.Minute())
+	day := t.Weekday()
+
+	if w.From <= w.To {
+		return w.onDay(day) && now >= w.From && now < w.To
+	}
+
+	// the window wraps around midnight, so the part after midnight belongs to the previous day
+	previousDay := (day + 6) % 7
+	return (w.onDay(day) && now >= w.From) || (w.onDay(previousDay) && now < w.To)
+}
+
+func (w *UpdateWindow) onDay(day time.Weekday) bool {
+	if len(w.Days) == 0 {
+		return true
+	}
+
+	for _, windowDay := range w.Days {
+		if time.Weekday(windowDay) == day {
+			return true
+		}
+	}
+	return false
+}
+
+// ClockTime is a time of the day in minutes since midnight, written as "15:04" in the config
+type ClockTime int
+
+func (c *ClockTime) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+
+	parsed, err := time.Parse("15:04", value)
+	if err != nil {
+		return err
+	}
+	*c = ClockTime(parsed.Hour()*60 + parsed.Minute())
+	return nil
+}
+
+func (c ClockTime) MarshalJSON() ([]byte, error) {
+	return json.Marshal(fmt.Sprintf("%02d:%02d", c/60, c%60))
+}
+
+// Weekday is a time.Weekday written as its english name like "Monday" or "Mon" in the config
+type Weekday time.Weekday
+
+func (d *Weekday) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		if strings.EqualFold(value, day.String()) || strings.EqualFold(value, day.String()[:3]) {
+			*d = Weekday(day)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown weekday %s", value)
+}
+
+func (d Weekday) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Weekday(d).String())
+}
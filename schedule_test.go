@@ -0,0 +1,33 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestUpdateWindowContains(t *testing.T) {
+	overnight := UpdateWindow{Days: []Weekday{Weekday(time.Saturday)}, From: 22 * 60, To: 6 * 60}
+	empty := UpdateWindow{From: 22 * 60, To: 22 * 60}
+	saturday := func(day int, hour int) time.Time {
+		return time.Date(2026, time.October, 17+day, hour, 0, 0, 0, time.Local)
+	}
+
+	tests := []struct {
+		name     string
+		window   UpdateWindow
+		at       time.Time
+		expected bool
+	}{
+		{"before midnight on the day", overnight, saturday(0, 23), true},
+		{"after midnight of the day", overnight, saturday(1, 5), true},
+		{"before midnight on the next day", overnight, saturday(1, 23), false},
+		{"after midnight before the day", overnight, saturday(0, 5), false},
+		{"at the end", overnight, saturday(1, 6), false},
+		{"from equal to", empty, saturday(0, 22), false},
+	}
+	for _, test := range tests {
+		if contains := test.window.contains(test.at); contains != test.expected {
+			t.Errorf("%s: contains(%s) returned %t, want %t", test.name, test.at.Format("Mon 15:04"), contains, test.expected)
+		}
+	}
+}
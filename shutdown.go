@@ -0,0 +1,35 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// notifyShutdown returns a context that is cancelled on SIGTERM or an interrupt, which lets the daemon finish
+// the record it is currently updating. If that takes longer than the grace period or a second signal
+// is received, the process exits immediately. On Windows closing the console, logging off and shutting down
+// are delivered as SIGTERM as well, which is also how service wrappers stop the process.
+func notifyShutdown(gracePeriod time.Duration) context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		received := <-signals
+		log.Printf("received %s, shutting down after the current record within %s\n", received, gracePeriod)
+		cancel()
+
+		timeout := time.NewTimer(gracePeriod)
+		select {
+		case <-timeout.C:
+			errorLog.Fatalln("could not finish the current record within the shutdown grace period")
+		case received = <-signals:
+			errorLog.Fatalln("received", received, "again, exiting immediately")
+		}
+	}()
+	return ctx
+}
@@ -0,0 +1,508 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"os/exec"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// errSourceUnavailable is returned when no connection to the source could be established
+// or no interface has a usable address
+var errSourceUnavailable = errors.New("source unavailable")
+
+// errTooManyRedirects and errInsecureRedirect are returned when a redirect of a source isn't followed,
+// unlike errSourceUnavailable they don't change on a retry
+var (
+	errTooManyRedirects = errors.New("too many redirects")
+	errInsecureRedirect = errors.New("insecure redirect")
+)
+
+// maxSourceResponseSize limits how much of the response of a source is read, an address is at most 45 characters long
+const maxSourceResponseSize = 1024
+
+// maxJsonSourceResponseSize is the limit for sources with a SourcePath, whose json responses often contain
+// details like the location and the provider of the address as well
+const maxJsonSourceResponseSize = 64 << 10
+
+// IPSource detects the public address for a record type
+type IPSource interface {
+	Detect(ctx context.Context, recordType string) (net.IP, error)
+}
+
+// newIPSource creates the source that is configured for the record type
+func newIPSource(config *DynDnsConfig, recordConfig *RecordConfig) IPSource {
+	var source IPSource
+	if recordConfig.FromIPv4 != "" {
+		source = &ipv4DerivedSource{config: config, template: recordConfig.FromIPv4}
+	} else if len(recordConfig.Interfaces) > 0 {
+		source = &interfaceSource{interfaceNames: recordConfig.Interfaces}
+	} else if service, ok := strings.CutPrefix(recordConfig.Source, "metadata:"); ok {
+		source = &metadataSource{service: service}
+	} else if server, ok := strings.CutPrefix(recordConfig.Source, "stun:"); ok {
+		source = &stunSource{config: config, recordConfig: recordConfig, server: server}
+	} else if command, ok := strings.CutPrefix(recordConfig.Source, "command:"); ok {
+		source = &commandSource{command: strings.Fields(command), extractFirst: recordConfig.SourceExtractFirst}
+	} else {
+		source = &httpSource{config: config, recordConfig: recordConfig}
+	}
+
+	if recordConfig.EUI64Interface != "" {
+		source = &eui64Source{prefix: source, interfaceName: recordConfig.EUI64Interface}
+	}
+	return source
+}
+
+// sourceLabel describes where the address of the record config comes from
+func sourceLabel(recordConfig *RecordConfig) string {
+	if recordConfig.FromIPv4 != "" {
+		return "FromIPv4 " + recordConfig.FromIPv4
+	} else if len(recordConfig.Interfaces) > 0 {
+		return "interfaces " + strings.Join(recordConfig.Interfaces, ",")
+	}
+	return recordConfig.Source
+}
+
+func getPublicIP(config *DynDnsConfig, recordType string, recordConfig *RecordConfig) (net.IP, error) {
+	return newIPSource(config, recordConfig).Detect(context.Background(), recordType)
+}
+
+// parseSourceResponse parses the address a source responded with
+func parseSourceResponse(source string, response []byte) (net.IP, error) {
+	ip := net.ParseIP(string(response))
+	if ip == nil {
+		return nil, fmt.Errorf("source %s returned a response that is not an ip address %q", source, truncate(string(response), 100))
+	}
+	return ip, nil
+}
+
+// ipTokenPattern matches words that could be an address, they are checked by parsing them
+var ipTokenPattern = regexp.MustCompile(`[0-9A-Fa-f:.]*[:.][0-9A-Fa-f:.]*`)
+
+// extractFirstIP returns the first word of the response that is an address, or the response itself
+// if there is none so that the error still shows what the source returned
+func extractFirstIP(response []byte) []byte {
+	for _, token := range ipTokenPattern.FindAll(response, -1) {
+		if net.ParseIP(string(token)) != nil {
+			return token
+		}
+		// punctuation like the dot at the end of a sentence is matched as part of the word, it is
+		// trimmed from the end first so that addresses starting with :: like ::1 stay intact
+		for _, trimmed := range [][]byte{bytes.TrimRight(token, ".:"), bytes.Trim(token, ".:")} {
+			if net.ParseIP(string(trimmed)) != nil {
+				return trimmed
+			}
+		}
+	}
+	return response
+}
+
+// httpSource requests the address from a service that responds with the address of the client
+type httpSource struct {
+	config       *DynDnsConfig
+	recordConfig *RecordConfig
+}
+
+func (s *httpSource) Detect(ctx context.Context, recordType string) (net.IP, error) {
+	network := "tcp"
+	if s.recordConfig.ForceFamily {
+		network = sourceNetwork(recordType)
+	}
+
+	maxRedirects := s.recordConfig.MaxRedirects
+	if !s.recordConfig.FollowRedirects {
+		maxRedirects = 0
+	}
+	client := newSourceClient(network, s.config.SourceResolver, maxRedirects)
+
+	var response []byte
+	var err error
+	for attempt := 0; attempt <= s.recordConfig.SourceRetries; attempt++ {
+		if attempt > 0 {
+			log.Printf("retrying source %s %v\n", s.recordConfig.Source, err)
+		}
+		// only the connection can fail temporarily, a response that can't be used won't change on a retry
+		if response, err = s.fetch(ctx, client); err == nil || !errors.Is(err, errSourceUnavailable) {
+			break
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if s.recordConfig.SourcePath != "" {
+		extracted, err := extractJsonPath(response, s.recordConfig.SourcePath)
+		if err != nil {
+			return nil, fmt.Errorf("source %s returned an unexpected response %w", s.recordConfig.Source, err)
+		}
+		response = []byte(extracted)
+	}
+	if s.recordConfig.SourceExtractFirst {
+		response = extractFirstIP(response)
+	}
+
+	return parseSourceResponse(s.recordConfig.Source, response)
+}
+
+// fetch requests the source once and returns the body of its response. SourceTimeout applies to the whole
+// request including reading the body, so a connection that stalls in the middle of the response can't block the run
+func (s *httpSource) fetch(ctx context.Context, client *http.Client) ([]byte, error) {
+	if s.recordConfig.SourceTimeout.Duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.recordConfig.SourceTimeout.Duration)
+		defer cancel()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", s.recordConfig.Source, http.NoBody)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := client.Do(req)
+	if errors.Is(err, errTooManyRedirects) || errors.Is(err, errInsecureRedirect) {
+		return nil, fmt.Errorf("could not fetch ip from %s %w", s.recordConfig.Source, err)
+	} else if err != nil {
+		return nil, &NetworkError{Err: fmt.Errorf("%w: could not fetch ip from %s %w", errSourceUnavailable, s.recordConfig.Source, err)}
+	}
+	defer func(Body io.ReadCloser) {
+		_ = Body.Close()
+	}(res.Body)
+
+	if !slices.Contains(s.recordConfig.AcceptedStatusCodes, res.StatusCode) {
+		return nil, fmt.Errorf("source %s returned unexpected status %d", s.recordConfig.Source, res.StatusCode)
+	}
+
+	if contentType := res.Header.Get("Content-Type"); !acceptsContentType(s.recordConfig.AcceptedContentTypes, contentType) {
+		return nil, fmt.Errorf("source %s returned unexpected content type %q, accepted are %v", s.recordConfig.Source, contentType, s.recordConfig.AcceptedContentTypes)
+	}
+
+	body, err := decodedBody(res)
+	if err != nil {
+		return nil, fmt.Errorf("could not decode response of source %s %w", s.recordConfig.Source, err)
+	}
+	limit := maxSourceResponseSize
+	if s.recordConfig.SourcePath != "" {
+		limit = maxJsonSourceResponseSize
+	}
+	// one more byte than the limit is read to tell a response that is too large apart from one that fits exactly
+	response, err := io.ReadAll(io.LimitReader(body, int64(limit)+1))
+	if err != nil {
+		return nil, &NetworkError{Err: fmt.Errorf("%w: could not read response of %s %w", errSourceUnavailable, s.recordConfig.Source, err)}
+	}
+
+	if isHtml(res.Header.Get("Content-Type"), response) {
+		return nil, fmt.Errorf("source %s returned a html page instead of an ip address, final url was %s", s.recordConfig.Source, res.Request.URL)
+	} else if len(response) > limit {
+		return nil, fmt.Errorf("source %s returned a response larger than %d bytes", s.recordConfig.Source, limit)
+	}
+	// many sources end the address with a newline
+	return bytes.TrimSpace(response), nil
+}
+
+// decodedBody returns the body of the response, decompressing it if the source sent a gzip encoded response
+// that the transport hasn't decompressed already because it didn't ask for it. The size limit of the
+// caller applies to the decompressed body
+func decodedBody(res *http.Response) (io.Reader, error) {
+	if res.Uncompressed || !strings.EqualFold(res.Header.Get("Content-Encoding"), "gzip") {
+		return res.Body, nil
+	}
+	return gzip.NewReader(res.Body)
+}
+
+// metadataClient doesn't use a proxy because the metadata services are only reachable from the host itself
+var metadataClient = &http.Client{
+	Timeout:   5 * time.Second,
+	Transport: &http.Transport{Proxy: nil},
+}
+
+// metadataSource reads the public ip from the metadata service of a cloud provider
+type metadataSource struct {
+	service string
+}
+
+func (s *metadataSource) Detect(ctx context.Context, recordType string) (net.IP, error) {
+	var endpoint string
+	switch {
+	case s.service == "hetzner" && recordType == "A":
+		endpoint = "http://169.254.169.254/hetzner/v1/metadata/public-ipv4"
+	case s.service == "hetzner":
+		return nil, fmt.Errorf("the hetzner metadata service only provides the public ipv4 address, not %s records", recordType)
+	default:
+		return nil, fmt.Errorf("unknown metadata service %s", s.service)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoint, http.NoBody)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := metadataClient.Do(req)
+	if err != nil {
+		return nil, &NetworkError{Err: fmt.Errorf("%w: could not reach metadata service %s %w", errSourceUnavailable, s.service, err)}
+	}
+	defer func(Body io.ReadCloser) {
+		_ = Body.Close()
+	}(res.Body)
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("metadata service %s returned unexpected status %d", s.service, res.StatusCode)
+	}
+
+	ip, err := io.ReadAll(io.LimitReader(res.Body, maxSourceResponseSize))
+	if err != nil {
+		return nil, fmt.Errorf("could not read response %w", err)
+	}
+
+	return parseSourceResponse("metadata:"+s.service, bytes.TrimSpace(ip))
+}
+
+// commandSource runs a command that prints the address to stdout
+type commandSource struct {
+	command      []string
+	extractFirst bool
+}
+
+func (s *commandSource) Detect(ctx context.Context, _ string) (net.IP, error) {
+	if len(s.command) == 0 {
+		return nil, errors.New("command source has no command")
+	}
+
+	output, err := exec.CommandContext(ctx, s.command[0], s.command[1:]...).Output()
+	if err != nil {
+		return nil, fmt.Errorf("%w: command %s failed %w", errSourceUnavailable, s.command[0], err)
+	}
+
+	output = bytes.TrimSpace(output)
+	if s.extractFirst {
+		output = extractFirstIP(output)
+	}
+	return parseSourceResponse(s.command[0], output)
+}
+
+// eui64Source replaces the interface identifier of the address from the prefix source
+// with the EUI-64 derived from the mac address of the interface
+type eui64Source struct {
+	prefix        IPSource
+	interfaceName string
+}
+
+func (s *eui64Source) Detect(ctx context.Context, recordType string) (net.IP, error) {
+	prefixIp, err := s.prefix.Detect(ctx, recordType)
+	if err != nil {
+		return nil, err
+	} else if prefixIp.To4() != nil {
+		return nil, fmt.Errorf("prefix source returned %s which is not an ipv6 address", prefixIp)
+	}
+
+	networkInterface, err := net.InterfaceByName(s.interfaceName)
+	if err != nil {
+		return nil, fmt.Errorf("could not find interface %s for the EUI-64 %w", s.interfaceName, err)
+	}
+	mac := networkInterface.HardwareAddr
+	if len(mac) != 6 {
+		return nil, fmt.Errorf("interface %s has no 48 bit mac address to derive an EUI-64 from", s.interfaceName)
+	}
+
+	ip := make(net.IP, net.IPv6len)
+	copy(ip, prefixIp.To16()[:8])
+	ip[8] = mac[0] ^ 0x02
+	ip[9], ip[10] = mac[1], mac[2]
+	ip[11], ip[12] = 0xff, 0xfe
+	ip[13], ip[14], ip[15] = mac[3], mac[4], mac[5]
+
+	return ip, nil
+}
+
+// ipv4DerivedSource computes the address from the public IPv4 detected with the A config
+type ipv4DerivedSource struct {
+	config   *DynDnsConfig
+	template string
+}
+
+func (s *ipv4DerivedSource) Detect(_ context.Context, _ string) (net.IP, error) {
+	ipv4, err := detectPublicIP(s.config, "A", &s.config.A)
+	if err != nil {
+		return nil, err
+	}
+
+	derived := deriveFromIPv4(s.template, ipv4)
+	ip := net.ParseIP(derived)
+	if ip == nil {
+		return nil, fmt.Errorf("FromIPv4 template resulted in %q which is not an ip address", derived)
+	}
+	return ip, nil
+}
+
+// deriveFromIPv4 fills the placeholders of the FromIPv4 template with the given IPv4 address
+func deriveFromIPv4(template string, ipv4 string) string {
+	ip := net.ParseIP(ipv4).To4()
+	prefix := fmt.Sprintf("2002:%02x%02x:%02x%02x", ip[0], ip[1], ip[2], ip[3])
+
+	return strings.NewReplacer("{6to4}", prefix, "{ipv4}", ip.String()).Replace(template)
+}
+
+// interfaceSource takes the first global address of the record type found on the interfaces
+type interfaceSource struct {
+	interfaceNames []string
+}
+
+func (s *interfaceSource) Detect(_ context.Context, recordType string) (net.IP, error) {
+	for i, interfaceName := range s.interfaceNames {
+		networkInterface, err := net.InterfaceByName(interfaceName)
+		if err != nil {
+			warningLog.Println("could not find interface", interfaceName, err)
+			continue
+		}
+		if networkInterface.Flags&net.FlagUp == 0 {
+			continue
+		}
+
+		addresses, err := networkInterface.Addrs()
+		if err != nil {
+			warningLog.Println("could not get addresses of interface", interfaceName, err)
+			continue
+		}
+
+		var ip net.IP
+		if recordType == "AAAA" {
+			ip, err = pickGlobalIPv6(addresses)
+		} else {
+			ip, err = pickGlobalIPv4(addresses)
+		}
+		if err == nil {
+			if i > 0 {
+				warningLog.Printf("falling back to interface %s for %s records, the interfaces before it have no global address\n", interfaceName, recordType)
+			}
+			return ip, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: none of the interfaces %v has a global address for %s records", errSourceUnavailable, s.interfaceNames, recordType)
+}
+
+// pickGlobalIPv4 returns the first public IPv4 address
+func pickGlobalIPv4(addresses []net.Addr) (net.IP, error) {
+	for _, address := range addresses {
+		ipNet, ok := address.(*net.IPNet)
+		if !ok || ipNet.IP.To4() == nil {
+			continue
+		}
+		if ipNet.IP.IsGlobalUnicast() && !ipNet.IP.IsPrivate() {
+			return ipNet.IP, nil
+		}
+	}
+
+	return nil, errors.New("no global ipv4 address")
+}
+
+// pickGlobalIPv6 returns the first IPv6 address with global scope. Link-local addresses (fe80::/10),
+// unique local addresses (fc00::/7) and other non-global scopes are never returned because they
+// can't be reached from the internet. Without a global address an error is returned instead of
+// falling back to another scope so that the next interface is tried. Temporary privacy addresses
+// (RFC 4941) are global as well and net.Addr doesn't carry the flag that marks them, so they are
+// treated like any other global address and the first one in the order of the interface is used
+func pickGlobalIPv6(addresses []net.Addr) (net.IP, error) {
+	for _, address := range addresses {
+		ipNet, ok := address.(*net.IPNet)
+		if !ok || ipNet.IP.To4() != nil || len(ipNet.IP) != net.IPv6len {
+			continue
+		}
+		if ipNet.IP.IsLinkLocalUnicast() || ipNet.IP.IsPrivate() || !ipNet.IP.IsGlobalUnicast() {
+			continue
+		}
+		return ipNet.IP, nil
+	}
+
+	return nil, errors.New("no global ipv6 address")
+}
+
+// sourceNetwork returns the network that has to be used to reach a source for the given record type
+func sourceNetwork(recordType string) string {
+	switch recordType {
+	case "A":
+		return "tcp4"
+	case "AAAA":
+		return "tcp6"
+	default:
+		return "tcp"
+	}
+}
+
+// acceptsContentType reports whether the media type of the content type is one of the accepted ones,
+// every content type is accepted if there are none
+func acceptsContentType(accepted []string, contentType string) bool {
+	if len(accepted) == 0 {
+		return true
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return slices.ContainsFunc(accepted, func(acceptedType string) bool {
+		return strings.EqualFold(acceptedType, mediaType)
+	})
+}
+
+// isHtml reports whether a response is a html page, which sources usually return for errors or captive portals
+func isHtml(contentType string, body []byte) bool {
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil && mediaType == "text/html" {
+		return true
+	}
+	return bytes.HasPrefix(bytes.TrimSpace(body), []byte("<"))
+}
+
+// newSourceClient creates a http client that only dials connections with the given network.
+// If resolverAddress is not empty hostnames are resolved using that DNS server.
+// At most maxRedirects redirects are followed and never from https to http
+func newSourceClient(network string, resolverAddress string, maxRedirects int) *http.Client {
+	dialer := &net.Dialer{}
+	if resolverAddress != "" {
+		dialer.Resolver = newResolver(resolverAddress)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = func(ctx context.Context, _ string, address string) (net.Conn, error) {
+		return dialer.DialContext(ctx, network, address)
+	}
+
+	return &http.Client{
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if maxRedirects <= 0 {
+				return http.ErrUseLastResponse
+			} else if len(via) > maxRedirects {
+				return fmt.Errorf("%w: stopped after %d redirects", errTooManyRedirects, maxRedirects)
+			} else if via[len(via)-1].URL.Scheme == "https" && req.URL.Scheme != "https" {
+				return fmt.Errorf("%w: refusing to follow redirect from https to %s", errInsecureRedirect, req.URL)
+			}
+			return nil
+		},
+	}
+}
+
+// newResolver creates a resolver that sends all queries to the given DNS server
+func newResolver(address string) *net.Resolver {
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		address = net.JoinHostPort(address, "53")
+	}
+
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network string, _ string) (net.Conn, error) {
+			dialer := &net.Dialer{}
+			return dialer.DialContext(ctx, network, address)
+		},
+	}
+}
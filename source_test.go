@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func ipNet(address string) *net.IPNet {
+	return &net.IPNet{IP: net.ParseIP(address), Mask: net.CIDRMask(64, 128)}
+}
+
+func TestPickGlobalIPv6(t *testing.T) {
+	tests := []struct {
+		name      string
+		addresses []net.Addr
+		want      string
+	}{
+		{"global", []net.Addr{ipNet("2001:db8::1")}, "2001:db8::1"},
+		{"skips link-local", []net.Addr{ipNet("fe80::1"), ipNet("2001:db8::1")}, "2001:db8::1"},
+		{"skips unique local", []net.Addr{ipNet("fd00::1"), ipNet("fc00::1"), ipNet("2001:db8::1")}, "2001:db8::1"},
+		{"skips ipv4", []net.Addr{ipNet("192.0.2.1"), ipNet("2001:db8::1")}, "2001:db8::1"},
+		// a temporary address looks like any other global address, the first one is used
+		{"temporary before stable", []net.Addr{ipNet("2001:db8::8d2c:41ff:fe3a:1b2c"), ipNet("2001:db8::1")}, "2001:db8::8d2c:41ff:fe3a:1b2c"},
+		{"only link-local and unique local", []net.Addr{ipNet("fe80::1"), ipNet("fd00::1")}, ""},
+		{"none", nil, ""},
+	}
+
+	for _, test := range tests {
+		ip, err := pickGlobalIPv6(test.addresses)
+		if test.want == "" {
+			if err == nil {
+				t.Errorf("%s: pickGlobalIPv6 returned %s, want an error", test.name, ip)
+			}
+		} else if err != nil || !ip.Equal(net.ParseIP(test.want)) {
+			t.Errorf("%s: pickGlobalIPv6 returned %s %v, want %s", test.name, ip, err, test.want)
+		}
+	}
+}
+
+func TestHttpSourceTrimsWhitespace(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("192.0.2.1\n"))
+	}))
+	defer server.Close()
+
+	recordConfig := &RecordConfig{Source: server.URL, AcceptedStatusCodes: []int{http.StatusOK}}
+	ip, err := newIPSource(&DynDnsConfig{}, recordConfig).Detect(context.Background(), "A")
+	if err != nil || !ip.Equal(net.ParseIP("192.0.2.1")) {
+		t.Errorf("Detect returned %s %v for a response with a trailing newline, want 192.0.2.1", ip, err)
+	}
+}
+
+func TestHttpSourceRedirectLimitIsNotRetried(t *testing.T) {
+	var requests int
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		http.Redirect(w, r, server.URL, http.StatusFound)
+	}))
+	defer server.Close()
+
+	recordConfig := &RecordConfig{Source: server.URL, FollowRedirects: true, MaxRedirects: 2, SourceRetries: 3, AcceptedStatusCodes: []int{http.StatusOK}}
+	_, err := newIPSource(&DynDnsConfig{}, recordConfig).Detect(context.Background(), "A")
+	if !errors.Is(err, errTooManyRedirects) || errors.Is(err, errSourceUnavailable) {
+		t.Errorf("Detect returned %v for a redirect loop, want errTooManyRedirects without errSourceUnavailable", err)
+	}
+	if requests != 3 {
+		t.Errorf("the source was requested %d times, want 3 without retries", requests)
+	}
+}
+
+func TestHttpSourceResponseSize(t *testing.T) {
+	padding := strings.Repeat(" ", 4096)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(`{"ip": "192.0.2.1", "padding": "` + padding + `"}`))
+	}))
+	defer server.Close()
+
+	recordConfig := &RecordConfig{Source: server.URL, SourcePath: ".ip", AcceptedStatusCodes: []int{http.StatusOK}}
+	ip, err := newIPSource(&DynDnsConfig{}, recordConfig).Detect(context.Background(), "A")
+	if err != nil || !ip.Equal(net.ParseIP("192.0.2.1")) {
+		t.Errorf("Detect returned %s %v for a large json response, want 192.0.2.1", ip, err)
+	}
+
+	recordConfig.SourcePath = ""
+	if _, err = newIPSource(&DynDnsConfig{}, recordConfig).Detect(context.Background(), "A"); err == nil || !strings.Contains(err.Error(), "larger than") {
+		t.Errorf("Detect returned %v for a response over the limit, want an error about its size", err)
+	}
+}
+
+func TestExtractFirstIP(t *testing.T) {
+	tests := []struct {
+		response string
+		want     string
+	}{
+		{"192.0.2.1 (via proxy)", "192.0.2.1"},
+		{"Your IP is 192.0.2.1.", "192.0.2.1"},
+		{"ip: 2001:db8::1\n", "2001:db8::1"},
+		{"loopback is ::1", "::1"},
+		{"address: ::ffff:192.0.2.1.", "::ffff:192.0.2.1"},
+		{"ip:192.0.2.1", "192.0.2.1"},
+		{"dead.beef 10.0.0.1", "10.0.0.1"},
+		{"nothing here.", "nothing here."},
+	}
+
+	for _, test := range tests {
+		if got := string(extractFirstIP([]byte(test.response))); got != test.want {
+			t.Errorf("extractFirstIP(%q) = %q, want %q", test.response, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// runState is persisted in the StateFile between runs
+type runState struct {
+	// Published holds the address of each record type that all records have been updated to
+	Published map[string]publishedAddress
+	// Observed holds the last detected address of each record type and Changes the times it changed
+	Observed map[string]string
+	Changes  map[string][]time.Time
+}
+
+type publishedAddress struct {
+	Address string
+	TTL     int
+	// Records are the names of the records that have the address, so that records that are added
+	// to the config later are still created
+	Records []string
+}
+
+// loadState reads the state file, a missing or broken file results in an empty state
+func loadState(statePath string) *runState {
+	state := newRunState()
+	if statePath == "" {
+		return state
+	}
+
+	data, err := os.ReadFile(statePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return state
+	} else if err != nil {
+		errorLog.Println("could not read state file", err)
+		return state
+	}
+
+	if err = json.Unmarshal(data, state); err != nil {
+		warningLog.Println("could not parse state file, ignoring it", err)
+		return newRunState()
+	}
+	if state.Published == nil {
+		state.Published = map[string]publishedAddress{}
+	}
+	if state.Observed == nil {
+		state.Observed = map[string]string{}
+	}
+	if state.Changes == nil {
+		state.Changes = map[string][]time.Time{}
+	}
+	return state
+}
+
+func newRunState() *runState {
+	return &runState{
+		Published: map[string]publishedAddress{},
+		Observed:  map[string]string{},
+		Changes:   map[string][]time.Time{},
+	}
+}
+
+func saveState(statePath string, state *runState) {
+	if statePath == "" {
+		return
+	}
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		errorLog.Println("could not encode state", err)
+		return
+	}
+
+	if err = os.WriteFile(statePath, data, 0600); err != nil {
+		errorLog.Println("could not write state file", err)
+	}
+}
+
+// unchanged reports whether all records of the type have already been updated to the address and ttl
+func (s *runState) unchanged(recordType string, address string, ttl int, records []string) bool {
+	published, ok := s.Published[recordType]
+	return ok && recordValuesEqual(recordType, published.Address, address) && published.TTL == ttl && slices.Equal(published.Records, records)
+}
+
+func (s *runState) publish(recordType string, address string, ttl int, records []string) {
+	s.Published[recordType] = publishedAddress{
+		Address: address,
+		TTL:     ttl,
+		Records: records,
+	}
+}
+
+// managedRecordNames returns the sorted names of all active records of the config
+func managedRecordNames(config *DynDnsConfig) []string {
+	var names []string
+	for zoneName, zoneConfig := range config.Zones {
+		for _, recordName := range zoneConfig.activeRecords() {
+			names = append(names, strings.Join([]string{recordName, zoneName}, "."))
+		}
+	}
+	slices.Sort(names)
+	return names
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+)
+
+// printStatus prints a table with the current value of every configured record
+// and whether it matches the public ip without changing anything
+func printStatus(config *DynDnsConfig) int {
+	writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintln(writer, "NAME\tTYPE\tVALUE\tTTL\tUP-TO-DATE")
+
+	for _, recordType := range config.RecordTypeOrder {
+		printRecordStatus(writer, config, recordType, config.recordConfig(recordType))
+	}
+
+	if err := writer.Flush(); err != nil {
+		errorLog.Println("could not write status", err)
+		return exitFailed
+	}
+	return 0
+}
+
+func printRecordStatus(writer *tabwriter.Writer, config *DynDnsConfig, recordType string, recordConfig *RecordConfig) {
+	if !recordConfig.Enabled {
+		return
+	}
+
+	ipString, err := detectPublicIP(config, recordType, recordConfig)
+	if err != nil {
+		errorLog.Println(err)
+	}
+
+	for _, provider := range config.providers() {
+		for zoneName, zoneConfig := range config.Zones {
+			for _, recordName := range zoneConfig.activeRecords() {
+				printZoneRecordStatus(writer, config, provider, zoneName, recordName, recordType, ipString)
+			}
+		}
+	}
+}
+
+func printZoneRecordStatus(writer *tabwriter.Writer, config *DynDnsConfig, provider *hetznerProvider, zoneName string, recordName string, recordType string, ipString string) {
+	value, ttl, upToDate := "-", "-", "unknown"
+
+	current, err := getCurrentRecord(provider, zoneName, recordName, recordType)
+	if err != nil {
+		errorLog.Println(provider.logPrefix() + err.Error())
+		value = "error"
+	} else if current == nil {
+		value = "missing"
+		upToDate = "no"
+	} else {
+		value = current.dynamicValue(config.KeepOtherValues)
+		ttl = strconv.Itoa(current.TTL)
+		if ipString != "" {
+			upToDate = "no"
+			if recordValuesEqual(recordType, ipString, value) {
+				upToDate = "yes"
+			}
+		}
+	}
+
+	_, _ = fmt.Fprintf(writer, "%s%s.%s\t%s\t%s\t%s\t%s\n", provider.logPrefix(), recordName, zoneName, recordType, value, ttl, upToDate)
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"time"
+)
+
+// Constants of the STUN protocol (RFC 5389) that are needed for a binding request
+const (
+	stunBindingRequest       = 0x0001
+	stunBindingSuccess       = 0x0101
+	stunMagicCookie          = 0x2112a442
+	stunHeaderSize           = 20
+	stunAttrMappedAddress    = 0x0001
+	stunAttrXorMappedAddress = 0x0020
+	stunDefaultPort          = "3478"
+)
+
+// stunSource learns the public address from the binding response of a STUN server,
+// which works for hosts that can only send udp to the outside
+type stunSource struct {
+	config       *DynDnsConfig
+	recordConfig *RecordConfig
+	server       string
+}
+
+func (s *stunSource) Detect(ctx context.Context, recordType string) (net.IP, error) {
+	server := s.server
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, stunDefaultPort)
+	}
+
+	dialer := &net.Dialer{}
+	if s.config.SourceResolver != "" {
+		dialer.Resolver = newResolver(s.config.SourceResolver)
+	}
+	network := strings.Replace(sourceNetwork(recordType), "tcp", "udp", 1)
+	conn, err := dialer.DialContext(ctx, network, server)
+	if err != nil {
+		return nil, &NetworkError{Err: fmt.Errorf("%w: could not reach stun server %s %w", errSourceUnavailable, s.server, err)}
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	// udp packets can get lost, so the request is sent again after every timeout
+	for attempt := 0; ; attempt++ {
+		ip, err := s.bind(conn)
+		if err == nil || !errors.Is(err, errSourceUnavailable) || attempt >= s.recordConfig.SourceRetries {
+			return ip, err
+		}
+		log.Printf("retrying stun server %s %v\n", s.server, err)
+	}
+}
+
+// bind sends a binding request and returns the mapped address of the response
+func (s *stunSource) bind(conn net.Conn) (net.IP, error) {
+	request := make([]byte, stunHeaderSize)
+	binary.BigEndian.PutUint16(request[0:2], stunBindingRequest)
+	binary.BigEndian.PutUint32(request[4:8], stunMagicCookie)
+	transactionID := request[8:20]
+	if _, err := rand.Read(transactionID); err != nil {
+		return nil, err
+	}
+
+	timeout := s.recordConfig.SourceTimeout.Duration
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return nil, err
+	}
+	if _, err := conn.Write(request); err != nil {
+		return nil, &NetworkError{Err: fmt.Errorf("%w: could not send stun request to %s %w", errSourceUnavailable, s.server, err)}
+	}
+
+	response := make([]byte, 1500)
+	for {
+		n, err := conn.Read(response)
+		if err != nil {
+			return nil, &NetworkError{Err: fmt.Errorf("%w: no stun response from %s %w", errSourceUnavailable, s.server, err)}
+		}
+		// responses to earlier attempts are ignored
+		if n >= stunHeaderSize && bytes.Equal(response[8:20], transactionID) {
+			return parseStunResponse(response[:n])
+		}
+	}
+}
+
+// parseStunResponse returns the address of the XOR-MAPPED-ADDRESS or MAPPED-ADDRESS attribute of a binding response
+func parseStunResponse(response []byte) (net.IP, error) {
+	if binary.BigEndian.Uint16(response[0:2]) != stunBindingSuccess {
+		return nil, fmt.Errorf("stun server responded with message type %#04x instead of a binding success", binary.BigEndian.Uint16(response[0:2]))
+	}
+
+	length := int(binary.BigEndian.Uint16(response[2:4]))
+	if stunHeaderSize+length > len(response) {
+		return nil, errors.New("stun response is shorter than its header says")
+	}
+
+	var mapped net.IP
+	attributes := response[stunHeaderSize : stunHeaderSize+length]
+	for len(attributes) >= 4 {
+		attrType := binary.BigEndian.Uint16(attributes[0:2])
+		attrLength := int(binary.BigEndian.Uint16(attributes[2:4]))
+		if 4+attrLength > len(attributes) {
+			break
+		}
+		value := attributes[4 : 4+attrLength]
+
+		switch attrType {
+		case stunAttrXorMappedAddress:
+			if ip := parseStunAddress(value); ip != nil {
+				// the address is xor-ed with the magic cookie followed by the transaction id
+				for i := range ip {
+					ip[i] ^= response[4+i]
+				}
+				return ip, nil
+			}
+		case stunAttrMappedAddress:
+			mapped = parseStunAddress(value)
+		}
+
+		// attributes are padded to a multiple of 4 bytes
+		attributes = attributes[min(len(attributes), 4+(attrLength+3)&^3):]
+	}
+
+	if mapped == nil {
+		return nil, errors.New("stun response contains no mapped address")
+	}
+	return mapped, nil
+}
+
+// parseStunAddress returns the address of a MAPPED-ADDRESS style attribute value or nil if it is invalid
+func parseStunAddress(value []byte) net.IP {
+	if len(value) < 4 {
+		return nil
+	}
+
+	var size int
+	switch value[1] {
+	case 0x01:
+		size = net.IPv4len
+	case 0x02:
+		size = net.IPv6len
+	default:
+		return nil
+	}
+	if len(value) < 4+size {
+		return nil
+	}
+	return net.IP(bytes.Clone(value[4 : 4+size]))
+}
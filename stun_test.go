@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+)
+
+var stunTestTransactionID = []byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12}
+
+// stunMessage builds a stun message with the test transaction id and the attributes
+func stunMessage(messageType uint16, attributes ...[]byte) []byte {
+	message := make([]byte, stunHeaderSize)
+	binary.BigEndian.PutUint16(message[0:2], messageType)
+	binary.BigEndian.PutUint32(message[4:8], stunMagicCookie)
+	copy(message[8:20], stunTestTransactionID)
+	for _, attribute := range attributes {
+		message = append(message, attribute...)
+	}
+	binary.BigEndian.PutUint16(message[2:4], uint16(len(message)-stunHeaderSize))
+	return message
+}
+
+// stunAddressAttribute encodes the address as a MAPPED-ADDRESS or, if xor is set, as a XOR-MAPPED-ADDRESS attribute
+func stunAddressAttribute(address string, xor bool) []byte {
+	ip, family := net.ParseIP(address).To4(), byte(0x01)
+	if ip == nil {
+		ip, family = net.ParseIP(address), 0x02
+	}
+
+	attrType := uint16(stunAttrMappedAddress)
+	value := append([]byte{0, family, 0x12, 0x34}, ip...)
+	if xor {
+		attrType = stunAttrXorMappedAddress
+		key := binary.BigEndian.AppendUint32(nil, stunMagicCookie)
+		key = append(key, stunTestTransactionID...)
+		for i := range ip {
+			value[4+i] ^= key[i]
+		}
+	}
+	return stunAttribute(attrType, value)
+}
+
+func stunAttribute(attrType uint16, value []byte) []byte {
+	attribute := binary.BigEndian.AppendUint16(nil, attrType)
+	attribute = binary.BigEndian.AppendUint16(attribute, uint16(len(value)))
+	attribute = append(attribute, value...)
+	for len(attribute)%4 != 0 {
+		attribute = append(attribute, 0)
+	}
+	return attribute
+}
+
+func TestParseStunResponse(t *testing.T) {
+	truncated := stunAddressAttribute("192.0.2.1", true)
+	tests := []struct {
+		name     string
+		response []byte
+		expected string
+	}{
+		{"xor ipv4", stunMessage(stunBindingSuccess, stunAddressAttribute("192.0.2.1", true)), "192.0.2.1"},
+		{"xor ipv6", stunMessage(stunBindingSuccess, stunAddressAttribute("2001:db8::1", true)), "2001:db8::1"},
+		{"xor preferred", stunMessage(stunBindingSuccess, stunAddressAttribute("198.51.100.1", false), stunAddressAttribute("192.0.2.1", true)), "192.0.2.1"},
+		{"mapped fallback", stunMessage(stunBindingSuccess, stunAttribute(0x8022, []byte("server")), stunAddressAttribute("192.0.2.1", false)), "192.0.2.1"},
+		{"truncated attribute", stunMessage(stunBindingSuccess, truncated[:len(truncated)-2]), ""},
+		{"longer than header", stunMessage(stunBindingSuccess, stunAddressAttribute("192.0.2.1", true))[:stunHeaderSize+4], ""},
+		{"error response", stunMessage(0x0111, stunAddressAttribute("192.0.2.1", true)), ""},
+	}
+	for _, test := range tests {
+		ip, err := parseStunResponse(test.response)
+		if test.expected == "" {
+			if err == nil {
+				t.Errorf("%s: parseStunResponse returned %s, want an error", test.name, ip)
+			}
+		} else if err != nil || !ip.Equal(net.ParseIP(test.expected)) {
+			t.Errorf("%s: parseStunResponse returned %s %v, want %s", test.name, ip, err, test.expected)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+// teardownTarget is a managed record that is removed by teardown
+type teardownTarget struct {
+	Provider *hetznerProvider
+	Zone     string
+	Name     string
+	Type     string
+	// OtherRecords are the values that are kept with KeepOtherValues, the rrset is deleted if there are none
+	OtherRecords []rrSetRecord
+}
+
+// teardown removes every record of the config after asking for confirmation, unless --yes is given.
+// With KeepOtherValues only the managed value is removed and with LabelCreatedRecords rrsets without
+// the label are kept, as they already existed before this tool
+func teardown(config *DynDnsConfig) int {
+	var targets []teardownTarget
+	failed := false
+	for _, recordType := range config.RecordTypeOrder {
+		if !config.recordConfig(recordType).Enabled {
+			continue
+		}
+
+		for _, provider := range config.providers() {
+			for zoneName, zoneConfig := range config.Zones {
+				for _, recordName := range zoneConfig.activeRecords() {
+					current, err := getCurrentRecord(provider, zoneName, recordName, recordType)
+					if err != nil {
+						errorLog.Println(provider.logPrefix() + err.Error())
+						failed = true
+						continue
+					} else if current == nil || current.dynamicValue(config.KeepOtherValues) == "" {
+						continue
+					} else if config.LabelCreatedRecords && current.Labels[managedByLabel] != managedByValue {
+						log.Printf(provider.logPrefix()+"keeping record %s.%s of type %s because it isn't labeled as managed\n", recordName, zoneName, recordType)
+						continue
+					}
+
+					targets = append(targets, teardownTarget{
+						Provider: provider, Zone: zoneName, Name: recordName, Type: recordType,
+						OtherRecords: current.otherRecords(config.KeepOtherValues),
+					})
+				}
+			}
+		}
+	}
+
+	if len(targets) == 0 {
+		log.Println("there are no managed records to remove")
+	} else if *dryRun {
+		for _, target := range targets {
+			log.Printf(target.Provider.logPrefix()+"would remove record %s.%s of type %s\n", target.Name, target.Zone, target.Type)
+		}
+	} else if confirmTeardown(targets) {
+		for _, target := range targets {
+			var err error
+			if len(target.OtherRecords) > 0 {
+				err = removeManagedValue(config, target.Provider, target.Zone, target.Name, target.Type, target.OtherRecords)
+			} else {
+				err = deleteRecord(config, target.Provider, target.Zone, target.Name, target.Type)
+			}
+			if err != nil {
+				errorLog.Println(target.Provider.logPrefix() + err.Error())
+				failed = true
+			}
+		}
+	}
+
+	if failed {
+		return exitFailed
+	}
+	return 0
+}
+
+// confirmTeardown lists the records and asks on stdin whether they should be removed
+func confirmTeardown(targets []teardownTarget) bool {
+	for _, target := range targets {
+		fmt.Printf("%s%s.%s %s\n", target.Provider.logPrefix(), target.Name, target.Zone, target.Type)
+	}
+	if *assumeYes {
+		return true
+	}
+
+	fmt.Printf("remove these %d records? [y/N] ", len(targets))
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	if answer = strings.ToLower(strings.TrimSpace(answer)); answer != "y" && answer != "yes" {
+		log.Println("not removing any records")
+		return false
+	}
+	return true
+}
@@ -0,0 +1,9 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+func notifyTriggerSignals() <-chan os.Signal {
+	return nil
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"os"
+	"runtime"
+	"time"
+)
+
+// startWatchdog exits the process with a dump of all goroutines if the run isn't finished within maxDuration,
+// so that the supervisor restarts a daemon that hangs. Restarting only the loop isn't safe because the hung
+// run would continue in the background. The returned function stops the watchdog after the run
+func startWatchdog(maxDuration time.Duration) func() {
+	if maxDuration <= 0 {
+		return func() {}
+	}
+
+	timer := time.AfterFunc(maxDuration, func() {
+		stack := make([]byte, 1<<20)
+		stack = stack[:runtime.Stack(stack, true)]
+		errorLog.Printf("run didn't finish within %s, exiting so that it can be restarted\n%s", maxDuration, stack)
+		os.Exit(exitFailed)
+	})
+	return func() {
+		timer.Stop()
+	}
+}
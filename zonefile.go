@@ -0,0 +1,50 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+)
+
+// writeZoneFile writes the records as BIND-style zone file lines grouped and sorted by zone
+func writeZoneFile(w io.Writer, records []managedRecord) {
+	records = slices.Clone(records)
+	slices.SortFunc(records, func(a, b managedRecord) int {
+		return cmp.Or(cmp.Compare(a.Zone, b.Zone), cmp.Compare(a.Name, b.Name), cmp.Compare(a.Type, b.Type))
+	})
+
+	currentZone := ""
+	for i, record := range records {
+		if i == 0 || record.Zone != currentZone {
+			currentZone = record.Zone
+			if err := writeZoneHeader(w, currentZone, i > 0); err != nil {
+				errorLog.Println("could not write zone file", err)
+				return
+			}
+		}
+
+		if _, err := fmt.Fprintf(w, "%s\t%d\tIN\t%s\t%s\n", record.Name, record.TTL, record.Type, record.Value); err != nil {
+			errorLog.Println("could not write zone file", err)
+			return
+		}
+	}
+}
+
+func writeZoneHeader(w io.Writer, zone string, separate bool) error {
+	if separate {
+		if _, err := fmt.Fprintln(w); err != nil {
+			return err
+		}
+	}
+
+	// zones referenced by their id have no name that could be used as origin
+	if _, err := strconv.ParseInt(zone, 10, 64); err == nil {
+		_, err = fmt.Fprintf(w, "; zone %s\n", zone)
+		return err
+	}
+
+	_, err := fmt.Fprintf(w, "$ORIGIN %s.\n", zone)
+	return err
+}